@@ -1,33 +1,107 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/orayew2002/gocal/math"
 )
 
+const prompt = "> "
+
 func main() {
-	tests := []string{
-		"12.5*(3-1)/4",
-		"2+3*4",
-		"10-6/3",
-		"(-3)+5",
-		"2*-3",
-		"2^3^2",
-		"5%2",
-		"7.5%2",
-		"(2+3)^(1+1)",
-		"-(3+4)*2",
-		"2^-3",
-		"1200%10",
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run evaluates the expression given with -e, or each expression in args,
+// and prints the results to stdout. With neither it starts a REPL on stdin.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("gocal", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	expr := fs.String("e", "", "evaluate this expression, print only its result and exit")
+	sciAbove := fs.Float64("sci-above", 1e15, "print results at or above this magnitude in scientific notation")
+	sciBelow := fs.Float64("sci-below", 1e-6, "print nonzero results below this magnitude in scientific notation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	format := func(v float64) string {
+		return math.FormatAuto(v, *sciBelow, *sciAbove)
+	}
+
+	if *expr != "" {
+		v, err := math.EvalExpression(*expr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, format(v))
+		return nil
+	}
+
+	if fs.NArg() == 0 {
+		return repl(stdin, stdout, format)
 	}
 
-	for _, s := range tests {
+	for _, s := range fs.Args() {
 		v, err := math.EvalExpression(s)
 		if err != nil {
-			fmt.Println(err.Error())
+			fmt.Fprintln(stdout, err.Error())
+			continue
 		}
 
-		fmt.Println(s, "=", v)
+		fmt.Fprintln(stdout, s, "=", format(v))
+	}
+	return nil
+}
+
+// repl evaluates stdin line by line until EOF or :quit. Assignments such
+// as "x = 2" persist for later lines, and :money toggles exact cents
+// arithmetic.
+func repl(stdin io.Reader, stdout io.Writer, format func(float64) string) error {
+	scope := math.NewScope()
+	money := false
+	sc := bufio.NewScanner(stdin)
+
+	for fmt.Fprint(stdout, prompt); sc.Scan(); fmt.Fprint(stdout, prompt) {
+		line := strings.TrimSpace(sc.Text())
+		switch line {
+		case "":
+			continue
+		case ":quit", ":q":
+			return nil
+		case ":money":
+			money = !money
+			if money {
+				fmt.Fprintln(stdout, "money mode on")
+			} else {
+				fmt.Fprintln(stdout, "money mode off")
+			}
+			continue
+		}
+
+		if money {
+			cents, err := math.EvalMoneyExpression(line)
+			if err != nil {
+				fmt.Fprintln(stdout, "error:", err)
+				continue
+			}
+			fmt.Fprintln(stdout, math.FormatCents(cents, 2))
+			continue
+		}
+
+		v, err := math.EvalProgram(line, scope)
+		if err != nil {
+			fmt.Fprintln(stdout, "error:", err)
+			continue
+		}
+		fmt.Fprintln(stdout, format(v))
 	}
+	fmt.Fprintln(stdout)
+	return sc.Err()
 }
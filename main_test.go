@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"2+3*4"}, "2+3*4 = 14\n"},
+		{[]string{"10^21"}, "10^21 = 1e+21\n"},
+		{[]string{"-sci-above", "1e3", "2^10"}, "2^10 = 1.024e+03\n"},
+		{[]string{"-sci-below", "0", "10^-9"}, "10^-9 = 0.000000001\n"},
+		{[]string{"1/4", "2^40"}, "1/4 = 0.25\n2^40 = 1099511627776\n"},
+	}
+
+	for _, tc := range cases {
+		var out strings.Builder
+		if err := run(tc.args, strings.NewReader(""), &out); err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.args, err)
+		}
+		if out.String() != tc.want {
+			t.Fatalf("wrong output for %q: got %q want %q", tc.args, out.String(), tc.want)
+		}
+	}
+
+	var out strings.Builder
+	if err := run([]string{"-sci-above", "x"}, strings.NewReader(""), &out); err == nil {
+		t.Fatalf("expected error for a bad flag value")
+	}
+}
+
+func TestRun_Expr(t *testing.T) {
+	var out strings.Builder
+	if err := run([]string{"-e", "2^10"}, strings.NewReader(""), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "1024\n" {
+		t.Fatalf("wrong output: got %q", out.String())
+	}
+
+	if err := run([]string{"-e", "2+"}, strings.NewReader(""), &out); err == nil {
+		t.Fatalf("expected -e to report evaluation errors")
+	}
+}
+
+func TestRun_REPL(t *testing.T) {
+	in := strings.Join([]string{
+		"2+3*4",
+		"",
+		"x = 1/4",
+		"x*2",
+		"2+",
+		":money",
+		"10/3",
+		"19.99*3",
+		":money",
+		"x",
+		":quit",
+		"1+1",
+	}, "\n")
+	want := strings.Join([]string{
+		"> 14",
+		"> > 0.25",
+		"> 0.5",
+		`> error: expression ends with an operator "+" at line 1, column 2`,
+		"> money mode on",
+		"> 3.33",
+		"> 59.97",
+		"> money mode off",
+		"> 0.25",
+		"> ",
+	}, "\n")
+
+	var out strings.Builder
+	if err := run(nil, strings.NewReader(in), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != want {
+		t.Fatalf("wrong output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := run(nil, strings.NewReader("1+1\n"), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "> 2\n> \n" {
+		t.Fatalf("wrong output at EOF: got %q", out.String())
+	}
+}
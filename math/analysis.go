@@ -0,0 +1,102 @@
+package math
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// StabilityEstimate returns the relative condition number of expr with
+// respect to variable at the given point, |x*f'(x)/f(x)|, using a central
+// finite difference. Large values flag formulas that amplify input error.
+func StabilityEstimate(expr, variable string, at float64) (float64, error) {
+	toks, err := tokenize(expr, Options{})
+	if err != nil {
+		return 0, err
+	}
+	rpn, err := toRPN(toks, Options{Vars: map[string]float64{}})
+	if err != nil {
+		return 0, err
+	}
+
+	f := func(x float64) (float64, error) {
+		return evalRPN(context.Background(), rpn, Options{Vars: map[string]float64{strings.ToLower(variable): x}})
+	}
+
+	fx, err := f(at)
+	if err != nil {
+		return 0, err
+	}
+	if fx == 0 {
+		return 0, errors.New("stability is undefined where the expression is zero")
+	}
+
+	h := 1e-6 * math.Max(math.Abs(at), 1)
+	hi, err := f(at + h)
+	if err != nil {
+		return 0, err
+	}
+	lo, err := f(at - h)
+	if err != nil {
+		return 0, err
+	}
+
+	cond := math.Abs(at * (hi - lo) / (2 * h) / fx)
+	if math.IsNaN(cond) {
+		return 0, fmt.Errorf("stability of %q is undefined at %v", expr, at)
+	}
+	return cond, nil
+}
+
+// cfTolerance is the fractional remainder below which ContinuedFraction
+// treats the expansion as finished, absorbing float rounding in rational
+// values such as 0.1.
+const cfTolerance = 1e-9
+
+// ContinuedFraction evaluates expr and returns up to terms coefficients of
+// its continued fraction expansion. Fewer are returned when the value is
+// rational and the expansion ends early.
+func ContinuedFraction(expr string, terms int) ([]int64, error) {
+	if terms <= 0 {
+		return nil, fmt.Errorf("terms must be positive, got %d", terms)
+	}
+	x, err := EvalExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var coeffs []int64
+	for len(coeffs) < terms {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return nil, fmt.Errorf("continued fraction of %v is undefined", x)
+		}
+		a := math.Floor(x)
+		if a < math.MinInt64 || a >= math.MaxInt64 {
+			return nil, fmt.Errorf("continued fraction coefficient %v does not fit in int64", a)
+		}
+		coeffs = append(coeffs, int64(a))
+		frac := x - a
+		if frac < cfTolerance {
+			break
+		}
+		x = 1 / frac
+	}
+	return coeffs, nil
+}
+
+// EqualWithin reports whether a and b differ by at most eps. Two NaNs
+// are equal, as are infinities of the same sign.
+func EqualWithin(a, b, eps float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	if a == b {
+		return true
+	}
+	if math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return false
+	}
+	return math.Abs(a-b) <= eps
+}
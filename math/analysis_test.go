@@ -0,0 +1,100 @@
+package math
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestStabilityEstimate(t *testing.T) {
+	cases := []struct {
+		expr string
+		at   float64
+		want float64
+	}{
+		{"1/(x-1)", 1.001, 1001},
+		{"x^2", 3, 2},
+		{"2*x+0", 5, 1},
+	}
+
+	for _, tc := range cases {
+		got, err := StabilityEstimate(tc.expr, "x", tc.at)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if math.Abs(got-tc.want)/tc.want > 1e-3 {
+			t.Fatalf("wrong estimate for %q at %v: got %v want %v", tc.expr, tc.at, got, tc.want)
+		}
+	}
+
+	got, err := StabilityEstimate("1/(X-1)", "X", 1.01)
+	if err != nil {
+		t.Fatalf("unexpected error for a mixed-case variable: %v", err)
+	}
+	if math.Abs(got-101)/101 > 1e-3 {
+		t.Fatalf("wrong estimate for a mixed-case variable: got %v want 101", got)
+	}
+
+	if _, err := StabilityEstimate("y+1", "x", 1); err == nil {
+		t.Fatalf("expected error for unbound variable")
+	}
+	if _, err := StabilityEstimate("x-1", "x", 1); err == nil {
+		t.Fatalf("expected error where the expression is zero")
+	}
+}
+
+func TestContinuedFraction(t *testing.T) {
+	cases := []struct {
+		expr  string
+		terms int
+		want  []int64
+	}{
+		{"(1+sqrt(5))/2", 10, []int64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+		{"sqrt(2)", 6, []int64{1, 2, 2, 2, 2, 2}},
+		{"pi", 5, []int64{3, 7, 15, 1, 292}},
+		{"415/93", 10, []int64{4, 2, 6, 7}},
+		{"0.1", 5, []int64{0, 10}},
+		{"-0.5", 5, []int64{-1, 2}},
+		{"7", 3, []int64{7}},
+	}
+
+	for _, tc := range cases {
+		got, err := ContinuedFraction(tc.expr, tc.terms)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Fatalf("wrong continued fraction for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"1/0", "nan", "2^70"} {
+		if _, err := ContinuedFraction(expr, 3); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+	if _, err := ContinuedFraction("1", 0); err == nil {
+		t.Fatalf("expected error for zero terms")
+	}
+}
+
+func TestEqualWithin(t *testing.T) {
+	cases := []struct {
+		a, b, eps float64
+		want      bool
+	}{
+		{1, 1, 0, true},
+		{1, 1.0005, 1e-3, true},
+		{1, 1.002, 1e-3, false},
+		{math.NaN(), math.NaN(), 0, true},
+		{math.NaN(), 1, math.Inf(1), false},
+		{math.Inf(1), math.Inf(1), 0, true},
+		{math.Inf(1), math.Inf(-1), math.Inf(1), false},
+	}
+
+	for _, tc := range cases {
+		if got := EqualWithin(tc.a, tc.b, tc.eps); got != tc.want {
+			t.Fatalf("EqualWithin(%v, %v, %v) = %v, want %v", tc.a, tc.b, tc.eps, got, tc.want)
+		}
+	}
+}
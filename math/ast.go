@@ -0,0 +1,365 @@
+package math
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is a node of a parsed expression tree. String renders the node
+// back to source with only the parentheses precedence requires.
+type Expr interface {
+	String() string
+}
+
+// NumberLit is a numeric literal or named constant.
+type NumberLit struct {
+	Value float64
+	Text  string
+}
+
+// UnaryExpr is a prefix operator: "-", "+" or "!".
+type UnaryExpr struct {
+	Op string
+	X  Expr
+}
+
+// BinaryExpr is an infix operator applied to two operands.
+type BinaryExpr struct {
+	Op          string
+	Left, Right Expr
+}
+
+// CondExpr is the conditional Cond ? Then : Else.
+type CondExpr struct {
+	Cond, Then, Else Expr
+}
+
+// CallExpr is a function call.
+type CallExpr struct {
+	Name string
+	Args []Expr
+}
+
+var (
+	unaryOps     = map[string]string{"NEG": "-", "POS": "+", "NOT": "!"}
+	unaryOpNames = map[string]string{"-": "NEG", "+": "POS", "!": "NOT"}
+)
+
+// Parse builds an expression tree from s.
+func Parse(s string) (Expr, error) {
+	toks, err := tokenize(s, Options{})
+	if err != nil {
+		return nil, err
+	}
+	rpn, err := toRPN(toks, Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	var st []Expr
+	popN := func(n int) ([]Expr, error) {
+		if len(st) < n {
+			return nil, errors.New("not enough operands")
+		}
+		args := make([]Expr, n)
+		copy(args, st[len(st)-n:])
+		st = st[:len(st)-n]
+		return args, nil
+	}
+
+	for _, t := range rpn {
+		switch t.Typ {
+		case TNumber, TPercent:
+			st = append(st, &NumberLit{Value: t.Value, Text: t.Text})
+
+		case TFunc:
+			args, err := popN(t.Arity)
+			if err != nil {
+				return nil, err
+			}
+			st = append(st, &CallExpr{Name: t.Text, Args: args})
+
+		case TOp:
+			if op, ok := unaryOps[t.Text]; ok {
+				args, err := popN(1)
+				if err != nil {
+					return nil, err
+				}
+				st = append(st, &UnaryExpr{Op: op, X: args[0]})
+				continue
+			}
+			if t.Text == "?:" {
+				args, err := popN(3)
+				if err != nil {
+					return nil, err
+				}
+				st = append(st, &CondExpr{Cond: args[0], Then: args[1], Else: args[2]})
+				continue
+			}
+			args, err := popN(2)
+			if err != nil {
+				return nil, err
+			}
+			st = append(st, &BinaryExpr{Op: t.Text, Left: args[0], Right: args[1]})
+
+		default:
+			return nil, fmt.Errorf("unexpected token %q", t.Text)
+		}
+	}
+
+	if len(st) != 1 {
+		return nil, errors.New("expression error: extra values")
+	}
+	return st[0], nil
+}
+
+// Eval evaluates an expression tree.
+func Eval(e Expr) (float64, error) {
+	rpn, err := flattenExpr(nil, e)
+	if err != nil {
+		return 0, err
+	}
+	return evalRPN(context.Background(), rpn, Options{})
+}
+
+func flattenExpr(out []Token, e Expr) ([]Token, error) {
+	var err error
+	switch n := e.(type) {
+	case *NumberLit:
+		out = append(out, Token{Typ: TNumber, Text: n.Text, Value: n.Value})
+
+	case *UnaryExpr:
+		if out, err = flattenExpr(out, n.X); err != nil {
+			return nil, err
+		}
+		name, ok := unaryOpNames[n.Op]
+		if !ok {
+			return nil, fmt.Errorf("unknown unary operator %q", n.Op)
+		}
+		out = append(out, Token{Typ: TOp, Text: name})
+
+	case *BinaryExpr:
+		for _, x := range []Expr{n.Left, n.Right} {
+			if out, err = flattenExpr(out, x); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, Token{Typ: TOp, Text: n.Op})
+
+	case *CondExpr:
+		for _, x := range []Expr{n.Cond, n.Then, n.Else} {
+			if out, err = flattenExpr(out, x); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, Token{Typ: TOp, Text: "?:"})
+
+	case *CallExpr:
+		for _, x := range n.Args {
+			if out, err = flattenExpr(out, x); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, Token{Typ: TFunc, Text: n.Name, Arity: len(n.Args)})
+
+	default:
+		return nil, fmt.Errorf("unknown expression node %T", e)
+	}
+	return out, nil
+}
+
+const leafPrecedence = 100
+
+func exprPrecedence(e Expr) int {
+	switch n := e.(type) {
+	case *UnaryExpr:
+		return precedence(unaryOpNames[n.Op])
+	case *BinaryExpr:
+		return precedence(n.Op)
+	case *CondExpr:
+		return precedence("?:")
+	default:
+		return leafPrecedence
+	}
+}
+
+func parenIf(cond bool, e Expr) string {
+	if cond {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+func (n *NumberLit) String() string {
+	if n.Text != "" {
+		return n.Text
+	}
+	return strconv.FormatFloat(n.Value, 'g', -1, 64)
+}
+
+func (n *UnaryExpr) String() string {
+	return n.Op + parenIf(exprPrecedence(n.X) < exprPrecedence(n), n.X)
+}
+
+func (n *BinaryExpr) String() string {
+	p := precedence(n.Op)
+	right := rightAssociative(n.Op)
+	lp, rp := exprPrecedence(n.Left), exprPrecedence(n.Right)
+	// A prefix operator on the right cannot capture the left operand, so
+	// 2^-3 needs no parentheses even though "-" binds looser than "^".
+	_, prefix := n.Right.(*UnaryExpr)
+	return parenIf(lp < p || lp == p && right, n.Left) + n.Op + parenIf(!prefix && (rp < p || rp == p && !right), n.Right)
+}
+
+func (n *CondExpr) String() string {
+	p := precedence("?:")
+	return parenIf(exprPrecedence(n.Cond) <= p, n.Cond) + "?" + n.Then.String() + ":" + n.Else.String()
+}
+
+func (n *CallExpr) String() string {
+	args := make([]string, len(n.Args))
+	for i, a := range n.Args {
+		args[i] = a.String()
+	}
+	return n.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// ToPrefix renders expr in space-separated Polish notation, e.g. "2+3*4"
+// becomes "+ 2 * 3 4". Unary operators are written neg, pos and not.
+func ToPrefix(expr string) (string, error) {
+	e, err := Parse(expr)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	if err := appendPrefix(&parts, e); err != nil {
+		return "", err
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func appendPrefix(parts *[]string, e Expr) error {
+	var children []Expr
+	switch n := e.(type) {
+	case *NumberLit:
+		*parts = append(*parts, n.String())
+	case *UnaryExpr:
+		*parts = append(*parts, strings.ToLower(unaryOpNames[n.Op]))
+		children = []Expr{n.X}
+	case *BinaryExpr:
+		*parts = append(*parts, n.Op)
+		children = []Expr{n.Left, n.Right}
+	case *CondExpr:
+		*parts = append(*parts, "?:")
+		children = []Expr{n.Cond, n.Then, n.Else}
+	case *CallExpr:
+		*parts = append(*parts, n.Name)
+		children = n.Args
+	default:
+		return fmt.Errorf("unknown expression node %T", e)
+	}
+	for _, c := range children {
+		if err := appendPrefix(parts, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExplainPrecedence describes how expr is grouped, one line per decision
+// from the innermost out, followed by the fully grouped result. For
+// "2+3*4" it yields "* binds tighter than +, so 3*4 is grouped first" and
+// "result: 2 + (3*4)".
+func ExplainPrecedence(expr string) ([]string, error) {
+	e, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	if err := explainNode(&lines, e); err != nil {
+		return nil, err
+	}
+	return append(lines, "result: "+groupedString(e)), nil
+}
+
+func explainNode(lines *[]string, e Expr) error {
+	switch n := e.(type) {
+	case *NumberLit:
+	case *UnaryExpr:
+		if err := explainNode(lines, n.X); err != nil {
+			return err
+		}
+		explainChild(lines, "unary "+n.Op, exprPrecedence(n), n.X, false)
+	case *BinaryExpr:
+		if err := explainNode(lines, n.Left); err != nil {
+			return err
+		}
+		if err := explainNode(lines, n.Right); err != nil {
+			return err
+		}
+		right := rightAssociative(n.Op)
+		explainChild(lines, n.Op, precedence(n.Op), n.Left, !right)
+		explainChild(lines, n.Op, precedence(n.Op), n.Right, right)
+	case *CondExpr:
+		for _, c := range []Expr{n.Cond, n.Then, n.Else} {
+			if err := explainNode(lines, c); err != nil {
+				return err
+			}
+		}
+	case *CallExpr:
+		for _, a := range n.Args {
+			if err := explainNode(lines, a); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown expression node %T", e)
+	}
+	return nil
+}
+
+// explainChild adds a line saying why child is grouped before the operator
+// op. assoc reports whether op's associativity favors child's side.
+func explainChild(lines *[]string, op string, p int, child Expr, assoc bool) {
+	bin, ok := child.(*BinaryExpr)
+	if !ok {
+		return
+	}
+	cp := precedence(bin.Op)
+	switch {
+	case cp > p:
+		*lines = append(*lines, fmt.Sprintf("%s binds tighter than %s, so %s is grouped first", bin.Op, op, bin))
+	case cp == p && assoc && bin.Op == op:
+		dir := "left"
+		if rightAssociative(op) {
+			dir = "right"
+		}
+		*lines = append(*lines, fmt.Sprintf("%s is %s-associative, so %s is grouped first", op, dir, bin))
+	case cp == p && assoc:
+		*lines = append(*lines, fmt.Sprintf("%s and %s have equal precedence and group left to right, so %s is grouped first", bin.Op, op, bin))
+	default:
+		*lines = append(*lines, fmt.Sprintf("parentheses group %s before %s", bin, op))
+	}
+}
+
+// groupedString renders e with its top-level operands parenthesized, so
+// the outermost operation stands out.
+func groupedString(e Expr) string {
+	group := func(x Expr) string {
+		switch x.(type) {
+		case *BinaryExpr, *CondExpr:
+			return "(" + x.String() + ")"
+		}
+		return x.String()
+	}
+	switch n := e.(type) {
+	case *BinaryExpr:
+		return group(n.Left) + " " + n.Op + " " + group(n.Right)
+	case *CondExpr:
+		return group(n.Cond) + " ? " + group(n.Then) + " : " + group(n.Else)
+	}
+	return e.String()
+}
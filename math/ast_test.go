@@ -0,0 +1,150 @@
+package math
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	e, err := Parse("2+3*4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bin, ok := e.(*BinaryExpr)
+	if !ok || bin.Op != "+" {
+		t.Fatalf("expected + at the root, got %#v", e)
+	}
+	if mul, ok := bin.Right.(*BinaryExpr); !ok || mul.Op != "*" {
+		t.Fatalf("expected * on the right, got %#v", bin.Right)
+	}
+	if got := e.String(); got != "2+3*4" {
+		t.Fatalf("wrong round trip: got %q want %q", got, "2+3*4")
+	}
+
+	v, err := Eval(e)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != 14 {
+		t.Fatalf("wrong result: got %v want 14", v)
+	}
+}
+
+func TestParse_EvalMatchesEvalExpression(t *testing.T) {
+	cases := []string{
+		"12.5*(3-1)/4",
+		"-(3+4)*2",
+		"2^3^2",
+		"(2^3)^2",
+		"max(10, 6%4 + 2^3) - min(5, 3+1)",
+		"1>0?5:6",
+		"0?1:0?2:3",
+		"!(1>2) && 3|4",
+		"sin(pi/6)^2+cos(pi/6)^2",
+	}
+
+	for _, expr := range cases {
+		want, err := EvalExpression(expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", expr, err)
+		}
+		e, err := Parse(expr)
+		if err != nil {
+			t.Fatalf("unexpected parse error for %q: %v", expr, err)
+		}
+		got, err := Eval(e)
+		if err != nil {
+			t.Fatalf("unexpected eval error for %q: %v", expr, err)
+		}
+		if math.Abs(got-want) > 1e-9 {
+			t.Fatalf("wrong result for %q: got %v want %v", expr, got, want)
+		}
+
+		reparsed, err := Parse(e.String())
+		if err != nil {
+			t.Fatalf("re-printed %q does not parse: %v", e.String(), err)
+		}
+		if again, _ := Eval(reparsed); math.Abs(again-want) > 1e-9 {
+			t.Fatalf("re-printed %q changed the result: got %v want %v", e.String(), again, want)
+		}
+	}
+
+	if _, err := Parse("2+"); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
+
+func TestToPrefix(t *testing.T) {
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"2+3*4", "+ 2 * 3 4"},
+		{"(2+3)*4", "* + 2 3 4"},
+		{"-(3+4)*2", "* neg + 3 4 2"},
+		{"2^-3", "^ 2 neg 3"},
+		{"max(1, 2+3)", "max 1 + 2 3"},
+		{"1>0?5:6", "?: > 1 0 5 6"},
+	}
+
+	for _, tc := range cases {
+		got, err := ToPrefix(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("ToPrefix(%q) = %q, want %q", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestExplainPrecedence(t *testing.T) {
+	cases := []struct {
+		expr string
+		want []string
+	}{
+		{"2+3*4", []string{
+			"* binds tighter than +, so 3*4 is grouped first",
+			"result: 2 + (3*4)",
+		}},
+		{"(2+3)*4", []string{
+			"parentheses group 2+3 before *",
+			"result: (2+3) * 4",
+		}},
+		{"1-2-3", []string{
+			"- is left-associative, so 1-2 is grouped first",
+			"result: (1-2) - 3",
+		}},
+		{"1-2+3", []string{
+			"- and + have equal precedence and group left to right, so 1-2 is grouped first",
+			"result: (1-2) + 3",
+		}},
+		{"2^3^2", []string{
+			"^ is right-associative, so 3^2 is grouped first",
+			"result: 2 ^ (3^2)",
+		}},
+		{"-(1+2)", []string{
+			"parentheses group 1+2 before unary -",
+			"result: -(1+2)",
+		}},
+		{"max(1, 2)", []string{
+			"result: max(1, 2)",
+		}},
+	}
+
+	for _, tc := range cases {
+		got, err := ExplainPrecedence(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Fatalf("wrong explanation for %q:\n%s\nwant:\n%s", tc.expr, strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+		}
+	}
+
+	if _, err := ExplainPrecedence("2+"); err == nil {
+		t.Fatalf("expected error for invalid expression")
+	}
+}
@@ -0,0 +1,164 @@
+package math
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// BatchOptions tunes EvalBatch.
+type BatchOptions struct {
+	// ShareSubexpressions evaluates a subexpression that appears in
+	// several expressions of the batch, such as "sqrt(2)", only once.
+	ShareSubexpressions bool
+}
+
+// EvalBatch evaluates exprs in order and returns their results. It stops at
+// the first expression that fails, reporting its index.
+func EvalBatch(exprs []string, opts BatchOptions) ([]float64, error) {
+	b := &batchEvaluator{}
+	if opts.ShareSubexpressions {
+		b.memo = map[string]float64{}
+	}
+
+	results := make([]float64, len(exprs))
+	for i, expr := range exprs {
+		e, err := Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("expression %d: %w", i, err)
+		}
+		if results[i], err = b.eval(e); err != nil {
+			return nil, fmt.Errorf("expression %d: %w", i, err)
+		}
+	}
+	return results, nil
+}
+
+// EvalAll evaluates every expression in exprs. Unlike EvalBatch it does
+// not stop at a failure: errs[i] is the error for exprs[i], and results[i]
+// is only meaningful when errs[i] is nil.
+func EvalAll(exprs []string) (results []float64, errs []error) {
+	results = make([]float64, len(exprs))
+	errs = make([]error, len(exprs))
+	for i, expr := range exprs {
+		results[i], errs[i] = evalExpression(context.Background(), expr, Options{})
+	}
+	return results, errs
+}
+
+// EvalAllConcurrent is like EvalAll but evaluates the expressions on up to
+// workers goroutines; workers <= 0 means runtime.NumCPU(). Evaluation
+// shares no mutable state, so the results match EvalAll.
+func EvalAllConcurrent(exprs []string, workers int) (results []float64, errs []error) {
+	workers = batchWorkers(workers, len(exprs))
+	results = make([]float64, len(exprs))
+	errs = make([]error, len(exprs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = evalExpression(context.Background(), exprs[i], Options{})
+			}
+		}()
+	}
+	for i := range exprs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results, errs
+}
+
+// batchWorkers is the number of goroutines EvalAllConcurrent starts for n
+// expressions.
+func batchWorkers(workers, n int) int {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return min(workers, n)
+}
+
+// batchEvaluator evaluates expression trees bottom-up. With a memo, every
+// subtree is keyed by its canonical String form; since batch expressions
+// have no variables, equal keys always have equal values.
+type batchEvaluator struct {
+	memo map[string]float64
+
+	// evalNode evaluates a node whose operands are literals. Nil means
+	// Eval; tests wrap it to observe which nodes are evaluated.
+	evalNode func(Expr) (float64, error)
+}
+
+func (b *batchEvaluator) eval(e Expr) (float64, error) {
+	if n, ok := e.(*NumberLit); ok {
+		return n.Value, nil
+	}
+
+	var key string
+	if b.memo != nil {
+		key = e.String()
+		if v, ok := b.memo[key]; ok {
+			return v, nil
+		}
+	}
+
+	var node Expr
+	switch n := e.(type) {
+	case *UnaryExpr:
+		x, err := b.literals(n.X)
+		if err != nil {
+			return 0, err
+		}
+		node = &UnaryExpr{Op: n.Op, X: x[0]}
+	case *BinaryExpr:
+		x, err := b.literals(n.Left, n.Right)
+		if err != nil {
+			return 0, err
+		}
+		node = &BinaryExpr{Op: n.Op, Left: x[0], Right: x[1]}
+	case *CondExpr:
+		x, err := b.literals(n.Cond, n.Then, n.Else)
+		if err != nil {
+			return 0, err
+		}
+		node = &CondExpr{Cond: x[0], Then: x[1], Else: x[2]}
+	case *CallExpr:
+		x, err := b.literals(n.Args...)
+		if err != nil {
+			return 0, err
+		}
+		node = &CallExpr{Name: n.Name, Args: x}
+	default:
+		return 0, fmt.Errorf("unknown expression node %T", e)
+	}
+
+	evalNode := b.evalNode
+	if evalNode == nil {
+		evalNode = Eval
+	}
+	v, err := evalNode(node)
+	if err != nil {
+		return 0, err
+	}
+	if b.memo != nil {
+		b.memo[key] = v
+	}
+	return v, nil
+}
+
+// literals evaluates each expression and wraps its value in a NumberLit.
+func (b *batchEvaluator) literals(exprs ...Expr) ([]Expr, error) {
+	out := make([]Expr, len(exprs))
+	for i, e := range exprs {
+		v, err := b.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = &NumberLit{Value: v}
+	}
+	return out, nil
+}
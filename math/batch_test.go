@@ -0,0 +1,145 @@
+package math
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestEvalBatch(t *testing.T) {
+	exprs := []string{
+		"sqrt(2)*2",
+		"1 + sqrt(2)",
+		"max(sqrt(2), 1) - sqrt(2)",
+		"2 > 1 ? sqrt(2) : 0",
+	}
+
+	for _, share := range []bool{false, true} {
+		got, err := EvalBatch(exprs, BatchOptions{ShareSubexpressions: share})
+		if err != nil {
+			t.Fatalf("unexpected error with sharing=%v: %v", share, err)
+		}
+		for i, expr := range exprs {
+			want, err := EvalExpression(expr)
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", expr, err)
+			}
+			if got[i] != want {
+				t.Fatalf("wrong result for %q with sharing=%v: got %v want %v", expr, share, got[i], want)
+			}
+		}
+	}
+
+	if _, err := EvalBatch([]string{"1+1", "2*"}, BatchOptions{}); err == nil {
+		t.Fatalf("expected error for invalid expression")
+	}
+}
+
+func TestEvalBatch_SharedCalls(t *testing.T) {
+	exprs := []string{"sqrt(2)*2", "1 + sqrt(2)", "max(sqrt(2), 1) - sqrt(2)", "sqrt(2)^2"}
+
+	count := func(share bool) int {
+		calls := 0
+		b := &batchEvaluator{evalNode: func(e Expr) (float64, error) {
+			if _, ok := e.(*CallExpr); ok {
+				calls++
+			}
+			return Eval(e)
+		}}
+		if share {
+			b.memo = map[string]float64{}
+		}
+		for _, expr := range exprs {
+			e, err := Parse(expr)
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", expr, err)
+			}
+			if _, err := b.eval(e); err != nil {
+				t.Fatalf("unexpected error for %q: %v", expr, err)
+			}
+		}
+		return calls
+	}
+
+	if got := count(false); got != 6 {
+		t.Fatalf("wrong call count without sharing: got %d want 6", got)
+	}
+	if got := count(true); got != 2 {
+		t.Fatalf("wrong call count with sharing: got %d want 2", got)
+	}
+}
+
+func BenchmarkEvalBatch_Shared(b *testing.B) {
+	exprs := make([]string, 100)
+	for i := range exprs {
+		exprs[i] = "sqrt(2)*hypot(3, 4) + " + string(rune('1'+i%9))
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := EvalBatch(exprs, BatchOptions{ShareSubexpressions: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEvalAll(t *testing.T) {
+	exprs := []string{"1+1", "2*", "sqrt(16)", "foo(1)", "", "10/4"}
+	wantOK := []float64{2, 0, 4, 0, 0, 2.5}
+	wantErr := []bool{false, true, false, true, true, false}
+
+	results, errs := EvalAll(exprs)
+	if len(results) != len(exprs) || len(errs) != len(exprs) {
+		t.Fatalf("wrong lengths: %d results, %d errors for %d expressions", len(results), len(errs), len(exprs))
+	}
+	for i, expr := range exprs {
+		if (errs[i] != nil) != wantErr[i] {
+			t.Fatalf("wrong error for %q at %d: %v", expr, i, errs[i])
+		}
+		if errs[i] == nil && results[i] != wantOK[i] {
+			t.Fatalf("wrong result for %q at %d: got %v want %v", expr, i, results[i], wantOK[i])
+		}
+	}
+
+	if results, errs := EvalAll(nil); len(results) != 0 || len(errs) != 0 {
+		t.Fatalf("expected empty results for no expressions")
+	}
+}
+
+func TestEvalAllConcurrent(t *testing.T) {
+	exprs := make([]string, 5000)
+	for i := range exprs {
+		switch i % 4 {
+		case 0:
+			exprs[i] = fmt.Sprintf("%d*(%d+1)/3", i, i)
+		case 1:
+			exprs[i] = fmt.Sprintf("sqrt(%d) + max(%d, 7)", i, i)
+		case 2:
+			exprs[i] = fmt.Sprintf("%d^2 - pi", i%50)
+		default:
+			exprs[i] = fmt.Sprintf("%d +", i)
+		}
+	}
+
+	want, wantErrs := EvalAll(exprs)
+	for _, workers := range []int{0, 1, 8} {
+		got, errs := EvalAllConcurrent(exprs, workers)
+		for i := range exprs {
+			if (errs[i] == nil) != (wantErrs[i] == nil) || got[i] != want[i] {
+				t.Fatalf("workers=%d: mismatch for %q: got %v, %v want %v, %v", workers, exprs[i], got[i], errs[i], want[i], wantErrs[i])
+			}
+		}
+	}
+
+	if got := batchWorkers(0, 1<<20); got != runtime.NumCPU() {
+		t.Fatalf("workers=0 should default to NumCPU=%d, got %d", runtime.NumCPU(), got)
+	}
+	if got := batchWorkers(-3, 1<<20); got != runtime.NumCPU() {
+		t.Fatalf("negative workers should default to NumCPU=%d, got %d", runtime.NumCPU(), got)
+	}
+	if got := batchWorkers(16, 3); got != 3 {
+		t.Fatalf("workers should not exceed the number of expressions, got %d", got)
+	}
+	if results, errs := EvalAllConcurrent(nil, 4); len(results) != 0 || len(errs) != 0 {
+		t.Fatalf("expected empty results for no expressions")
+	}
+}
@@ -0,0 +1,191 @@
+package math
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// BigOptions tunes EvalExpressionBigWithOptions. The zero value matches
+// EvalExpressionBig.
+type BigOptions struct {
+	// BigFuncs supplies one-argument functions such as sin or ln, which
+	// math/big does not provide. Results are rounded to the evaluation
+	// precision.
+	BigFuncs map[string]func(*big.Float) *big.Float
+}
+
+// EvalExpressionBig evaluates expr with big.Float arithmetic at prec bits
+// of mantissa. It supports + - * / %, unary signs and ^ with an integer
+// exponent; functions are rejected. Named constants such as pi are only as
+// precise as their float64 value; inf and nan are rejected.
+func EvalExpressionBig(expr string, prec uint) (*big.Float, error) {
+	return EvalExpressionBigWithOptions(expr, prec, BigOptions{})
+}
+
+// EvalExpressionBigWithOptions is like EvalExpressionBig but also calls the
+// functions in opts.BigFuncs.
+func EvalExpressionBigWithOptions(expr string, prec uint, opts BigOptions) (*big.Float, error) {
+	if prec == 0 {
+		return nil, errors.New("precision must be positive")
+	}
+	toks, err := tokenize(expr, Options{})
+	if err != nil {
+		return nil, err
+	}
+	rpn, err := toRPN(toks, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return evalRPNBig(rpn, prec, opts)
+}
+
+func evalRPNBig(rpn []Token, prec uint, opts BigOptions) (*big.Float, error) {
+	var st []*big.Float
+	newFloat := func() *big.Float { return new(big.Float).SetPrec(prec) }
+
+	pop := func() (*big.Float, error) {
+		if len(st) == 0 {
+			return nil, errors.New("not enough operands")
+		}
+		v := st[len(st)-1]
+		st = st[:len(st)-1]
+		return v, nil
+	}
+
+	for _, t := range rpn {
+		switch t.Typ {
+		case TNumber:
+			if !isDigit(t.Text[0]) && t.Text[0] != '.' {
+				if math.IsInf(t.Value, 0) || math.IsNaN(t.Value) {
+					return nil, fmt.Errorf("constant %q is not supported in big mode", t.Text)
+				}
+				st = append(st, newFloat().SetFloat64(t.Value))
+				continue
+			}
+			v, _, err := big.ParseFloat(strings.ReplaceAll(t.Text, "_", ""), 10, prec, big.ToNearestEven)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse number %q: %w", t.Text, err)
+			}
+			st = append(st, v)
+
+		case TFunc:
+			fn, ok := opts.BigFuncs[t.Text]
+			if !ok {
+				return nil, fmt.Errorf("function %q is not supported in big mode", t.Text)
+			}
+			if t.Arity != 1 {
+				return nil, fmt.Errorf("function %q expects 1 argument", t.Text)
+			}
+			a, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			res := fn(a)
+			if res == nil {
+				return nil, fmt.Errorf("function %q returned no value", t.Text)
+			}
+			st = append(st, newFloat().Set(res))
+
+		case TOp:
+			switch t.Text {
+			case "NEG":
+				a, err := pop()
+				if err != nil {
+					return nil, err
+				}
+				st = append(st, newFloat().Neg(a))
+
+			case "POS":
+				a, err := pop()
+				if err != nil {
+					return nil, err
+				}
+				st = append(st, a)
+
+			case "+", "-", "*", "/", "%", "^":
+				b, err := pop()
+				if err != nil {
+					return nil, err
+				}
+				a, err := pop()
+				if err != nil {
+					return nil, err
+				}
+
+				res := newFloat()
+				switch t.Text {
+				case "+":
+					res.Add(a, b)
+				case "-":
+					res.Sub(a, b)
+				case "*":
+					res.Mul(a, b)
+				case "/":
+					if b.Sign() == 0 {
+						return nil, errors.New("division by zero")
+					}
+					res.Quo(a, b)
+				case "%":
+					res.Mul(a, b)
+					res.Quo(res, newFloat().SetInt64(100))
+				case "^":
+					if res, err = powBig(a, b, prec); err != nil {
+						return nil, err
+					}
+				}
+				if res.IsInf() {
+					return nil, errors.New("result is out of big.Float range")
+				}
+				st = append(st, res)
+
+			default:
+				return nil, fmt.Errorf("operator %q is not supported in big mode", t.Text)
+			}
+
+		default:
+			return nil, fmt.Errorf("token %q is not supported in big mode", t.Text)
+		}
+	}
+
+	if len(st) != 1 {
+		return nil, errors.New("expression error: extra values")
+	}
+	return st[0], nil
+}
+
+func powBig(x, y *big.Float, prec uint) (*big.Float, error) {
+	if !y.IsInt() {
+		return nil, errors.New("big mode only supports integer exponents")
+	}
+	n, acc := y.Int64()
+	if acc != big.Exact {
+		return nil, errors.New("exponent is too large")
+	}
+	if n < 0 && x.Sign() == 0 {
+		return nil, errors.New("division by zero")
+	}
+
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	res := new(big.Float).SetPrec(prec).SetInt64(1)
+	base := new(big.Float).SetPrec(prec).Set(x)
+	for n > 0 {
+		if n&1 == 1 {
+			res.Mul(res, base)
+		}
+		base.Mul(base, base)
+		n >>= 1
+		if res.IsInf() || base.IsInf() && n > 0 {
+			return nil, errors.New("result is out of big.Float range")
+		}
+	}
+	if neg {
+		res.Quo(new(big.Float).SetPrec(prec).SetInt64(1), res)
+	}
+	return res, nil
+}
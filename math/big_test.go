@@ -0,0 +1,94 @@
+package math
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestEvalExpressionBig(t *testing.T) {
+	got, err := EvalExpressionBig("0.1+0.2", 200)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exact, _ := new(big.Float).SetPrec(200).SetString("0.3")
+	bigErr := new(big.Float).Sub(got, exact)
+	bigErr.Abs(bigErr)
+	floatErr := new(big.Float).Sub(new(big.Float).SetPrec(200).SetFloat64(0.1+0.2), exact)
+	floatErr.Abs(floatErr)
+	if bigErr.Cmp(floatErr) >= 0 {
+		t.Fatalf("big result %v is not closer to 0.3 than float64", got)
+	}
+
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"2^100", "1267650600228229401496703205376"},
+		{"2^-2", "0.25"},
+		{"-(3+4)*2", "-14"},
+		{"200%10", "20"},
+		{"12.5*(3-1)/4", "6.25"},
+	}
+	for _, tc := range cases {
+		got, err := EvalExpressionBig(tc.expr, 256)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		want, _ := new(big.Float).SetPrec(256).SetString(tc.want)
+		if got.Cmp(want) != 0 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got.Text('g', 40), tc.want)
+		}
+	}
+
+	for _, expr := range []string{"sqrt(2)", "2^0.5", "1/0", "0^-1", "1&1"} {
+		if _, err := EvalExpressionBig(expr, 64); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalExpressionBig_NonFiniteConstant(t *testing.T) {
+	for _, expr := range []string{"nan+1", "inf-inf", "0*inf", "inf/inf", "inf"} {
+		if _, err := EvalExpressionBig(expr, 64); err == nil {
+			t.Fatalf("expected error for %q in big mode", expr)
+		}
+	}
+}
+
+func TestEvalExpressionBigWithOptions_BigFuncs(t *testing.T) {
+	opts := BigOptions{
+		BigFuncs: map[string]func(*big.Float) *big.Float{
+			"sqrt": func(x *big.Float) *big.Float {
+				return new(big.Float).SetPrec(x.Prec()).Sqrt(x)
+			},
+		},
+	}
+
+	got, err := EvalExpressionBigWithOptions("sqrt(2)*sqrt(2)", 200, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	diff := new(big.Float).Sub(got, big.NewFloat(2))
+	if diff.Abs(diff).Cmp(big.NewFloat(1e-55)) > 0 {
+		t.Fatalf("sqrt(2)^2 is not 2 at 200 bits: got %v", got.Text('g', 60))
+	}
+
+	got, err = EvalExpressionBigWithOptions("sqrt(2)", 200, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := new(big.Float).SetPrec(200).Sqrt(new(big.Float).SetPrec(200).SetInt64(2))
+	if got.Cmp(want) != 0 || got.Prec() != 200 {
+		t.Fatalf("wrong sqrt: got %v want %v", got.Text('g', 60), want.Text('g', 60))
+	}
+
+	for _, expr := range []string{"ln(2)", "sqrt(1, 2)"} {
+		if _, err := EvalExpressionBigWithOptions(expr, 200, opts); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+	if _, err := EvalExpressionBig("sqrt(2)", 200); err == nil {
+		t.Fatalf("functions should be rejected without BigFuncs")
+	}
+}
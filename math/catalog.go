@@ -0,0 +1,119 @@
+package math
+
+// SymbolKind classifies a SymbolInfo.
+type SymbolKind int
+
+const (
+	KindOperator SymbolKind = iota
+	KindFunction
+	KindConstant
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case KindOperator:
+		return "operator"
+	case KindFunction:
+		return "function"
+	case KindConstant:
+		return "constant"
+	default:
+		return "unknown"
+	}
+}
+
+// SymbolInfo describes a built-in operator, function or constant.
+// MaxArity is -1 for variadic functions.
+type SymbolInfo struct {
+	Name        string
+	Kind        SymbolKind
+	MinArity    int
+	MaxArity    int
+	Description string
+}
+
+var catalog = []SymbolInfo{
+	{"+", KindOperator, 2, 2, "addition"},
+	{"-", KindOperator, 2, 2, "subtraction"},
+	{"*", KindOperator, 2, 2, "multiplication"},
+	{"/", KindOperator, 2, 2, "division"},
+	{"//", KindOperator, 2, 2, "floor division, floor(a/b)"},
+	{"%", KindOperator, 2, 2, "percent: a*b/100"},
+	{"^", KindOperator, 2, 2, "exponentiation, right-associative"},
+	{"NEG", KindOperator, 1, 1, "unary minus, binds looser than ^"},
+	{"POS", KindOperator, 1, 1, "unary plus, binds looser than ^"},
+	{"&", KindOperator, 2, 2, "bitwise AND on integers"},
+	{"|", KindOperator, 2, 2, "bitwise OR on integers"},
+	{"^^", KindOperator, 2, 2, "bitwise XOR on integers"},
+	{"<<", KindOperator, 2, 2, "left shift on integers"},
+	{">>", KindOperator, 2, 2, "right shift on integers"},
+	{"<", KindOperator, 2, 2, "less than, 1 or 0"},
+	{"<=", KindOperator, 2, 2, "less than or equal, 1 or 0"},
+	{">", KindOperator, 2, 2, "greater than, 1 or 0"},
+	{">=", KindOperator, 2, 2, "greater than or equal, 1 or 0"},
+	{"==", KindOperator, 2, 2, "equal, 1 or 0"},
+	{"!=", KindOperator, 2, 2, "not equal, 1 or 0"},
+	{"&&", KindOperator, 2, 2, "logical AND, 1 or 0"},
+	{"||", KindOperator, 2, 2, "logical OR, 1 or 0"},
+	{"!", KindOperator, 1, 1, "logical NOT, 1 or 0"},
+	{"?:", KindOperator, 3, 3, "conditional: cond ? a : b"},
+
+	{"sin", KindFunction, 1, 1, "sine of radians"},
+	{"cos", KindFunction, 1, 1, "cosine of radians"},
+	{"tan", KindFunction, 1, 1, "tangent of radians"},
+	{"asin", KindFunction, 1, 1, "arcsine in radians"},
+	{"acos", KindFunction, 1, 1, "arccosine in radians"},
+	{"atan", KindFunction, 1, 1, "arctangent in radians"},
+	{"deg", KindFunction, 1, 1, "radians converted to degrees"},
+	{"rad", KindFunction, 1, 1, "degrees converted to radians"},
+	{"sinh", KindFunction, 1, 1, "hyperbolic sine"},
+	{"cosh", KindFunction, 1, 1, "hyperbolic cosine"},
+	{"tanh", KindFunction, 1, 1, "hyperbolic tangent"},
+	{"asinh", KindFunction, 1, 1, "inverse hyperbolic sine"},
+	{"acosh", KindFunction, 1, 1, "inverse hyperbolic cosine"},
+	{"atanh", KindFunction, 1, 1, "inverse hyperbolic tangent"},
+	{"sqrt", KindFunction, 1, 1, "square root"},
+	{"cbrt", KindFunction, 1, 1, "cube root"},
+	{"abs", KindFunction, 1, 1, "absolute value"},
+	{"ln", KindFunction, 1, 1, "natural logarithm"},
+	{"log", KindFunction, 1, 1, "base-10 logarithm"},
+	{"exp", KindFunction, 1, 1, "e raised to x"},
+	{"floor", KindFunction, 1, 1, "round toward negative infinity"},
+	{"ceil", KindFunction, 1, 1, "round toward positive infinity"},
+	{"round", KindFunction, 1, 1, "round half away from zero"},
+	{"intpart", KindFunction, 1, 1, "integer part, truncated toward zero"},
+	{"fracpart", KindFunction, 1, 1, "fractional part with the sign of x"},
+	{"trunc", KindFunction, 1, 1, "round toward zero, same as intpart"},
+	{"frac", KindFunction, 1, 1, "fractional part, same as fracpart"},
+	{"min", KindFunction, 2, -1, "smallest argument"},
+	{"max", KindFunction, 2, -1, "largest argument"},
+	{"minmax", KindFunction, 1, -1, "pushes the largest then the smallest argument"},
+	{"sum", KindFunction, 1, -1, "sum of the arguments"},
+	{"avg", KindFunction, 1, -1, "arithmetic mean of the arguments"},
+	{"wavg", KindFunction, 2, -1, "weighted average of value, weight pairs"},
+	{"rmse", KindFunction, 2, -1, "root mean square error of prediction, actual pairs"},
+	{"pow", KindFunction, 2, 2, "x raised to y"},
+	{"atan2", KindFunction, 2, 2, "arctangent of y/x using both signs"},
+	{"copysign", KindFunction, 2, 2, "magnitude of x with the sign of y"},
+	{"hypot", KindFunction, 2, 2, "length of the hypotenuse, sqrt(a^2+b^2) without overflow"},
+	{"clamp", KindFunction, 3, 3, "x limited to the range [lo, hi]"},
+	{"gcd", KindFunction, 2, 2, "greatest common divisor of integers"},
+	{"lcm", KindFunction, 2, 2, "least common multiple of integers"},
+	{"fmod", KindFunction, 2, 2, "floored modulo with the sign of the divisor, pairs with //"},
+	{"root", KindFunction, 2, 2, "nth root of x"},
+	{"logn", KindFunction, 2, 2, "logarithm of x in base b"},
+
+	{"pi", KindConstant, 0, 0, "ratio of a circle's circumference to its diameter"},
+	{"e", KindConstant, 0, 0, "base of the natural logarithm"},
+	{"tau", KindConstant, 0, 0, "full turn in radians, 2*pi"},
+	{"phi", KindConstant, 0, 0, "golden ratio, (1+sqrt(5))/2"},
+	{"inf", KindConstant, 0, 0, "positive infinity"},
+	{"nan", KindConstant, 0, 0, "not a number"},
+}
+
+// Catalog lists the built-in operators, functions and constants.
+func Catalog() []SymbolInfo {
+	out := make([]SymbolInfo, len(catalog))
+	copy(out, catalog)
+	return out
+}
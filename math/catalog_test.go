@@ -0,0 +1,47 @@
+package math
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	byName := map[string]SymbolInfo{}
+	for _, info := range Catalog() {
+		byName[info.Name] = info
+	}
+
+	sin, ok := byName["sin"]
+	if !ok || sin.Kind != KindFunction || sin.MinArity != 1 || sin.MaxArity != 1 {
+		t.Fatalf("wrong catalog entry for sin: %+v", sin)
+	}
+	pi, ok := byName["pi"]
+	if !ok || pi.Kind != KindConstant {
+		t.Fatalf("wrong catalog entry for pi: %+v", pi)
+	}
+	if max := byName["max"]; max.MaxArity != -1 {
+		t.Fatalf("max should be variadic: %+v", max)
+	}
+
+	for name := range constants {
+		if info, ok := byName[name]; !ok || info.Kind != KindConstant {
+			t.Fatalf("constant %q missing from catalog", name)
+		}
+	}
+
+	for _, info := range Catalog() {
+		if info.Kind != KindFunction {
+			continue
+		}
+		args := strings.TrimSuffix(strings.Repeat("1,", info.MinArity), ",")
+		_, err := EvalExpression(info.Name + "(" + args + ")")
+		if err != nil && strings.Contains(err.Error(), "unknown function") {
+			t.Fatalf("catalog lists %q but the evaluator does not know it", info.Name)
+		}
+	}
+
+	Catalog()[0].Name = "changed"
+	if Catalog()[0].Name == "changed" {
+		t.Fatalf("Catalog should return a copy")
+	}
+}
@@ -0,0 +1,104 @@
+package math
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Program is a compiled expression that can be evaluated repeatedly with
+// different variable bindings.
+type Program struct {
+	rpn []Token
+}
+
+// Compile parses expr once for repeated evaluation. Bare identifiers that
+// are not constants become variables, bound when the Program is run.
+func Compile(expr string) (*Program, error) {
+	toks, err := tokenize(expr, Options{})
+	if err != nil {
+		return nil, err
+	}
+	rpn, err := toRPN(toks, Options{Vars: map[string]float64{}})
+	if err != nil {
+		return nil, err
+	}
+	return &Program{rpn: rpn}, nil
+}
+
+// Eval runs the program with vars bound to its variables.
+func (p *Program) Eval(vars map[string]float64) (float64, error) {
+	return evalRPN(context.Background(), p.rpn, Options{Vars: vars})
+}
+
+// Cache compiles each distinct expression once and keeps the most recently
+// used Programs. It is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	compile func(string) (*Program, error)
+}
+
+type cacheEntry struct {
+	expr string
+	prog *Program
+}
+
+// NewCache returns a Cache holding at most size Programs. A size of zero
+// or less means no limit.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		compile: Compile,
+	}
+}
+
+// Eval evaluates expr with vars, compiling it only if it is not cached.
+func (c *Cache) Eval(expr string, vars map[string]float64) (float64, error) {
+	prog, err := c.program(expr)
+	if err != nil {
+		return 0, err
+	}
+	return prog.Eval(vars)
+}
+
+func (c *Cache) program(expr string) (*Program, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[expr]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*cacheEntry).prog, nil
+	}
+
+	prog, err := c.compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[expr] = c.order.PushFront(&cacheEntry{expr: expr, prog: prog})
+	if c.size > 0 && c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).expr)
+	}
+	return prog, nil
+}
+
+// Len reports the number of cached Programs.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Purge removes every cached Program.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = map[string]*list.Element{}
+}
@@ -0,0 +1,104 @@
+package math
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	prog, err := Compile("x*2 + y")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		x, y, want float64
+	}{
+		{1, 1, 3},
+		{2.5, -1, 4},
+	} {
+		got, err := prog.Eval(map[string]float64{"x": tc.x, "y": tc.y})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for x=%v y=%v: got %v want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+
+	if got, err := prog.Eval(map[string]float64{"X": 1, "Y": 2}); err != nil || got != 4 {
+		t.Fatalf("wrong result for mixed-case keys: got %v, %v want 4", got, err)
+	}
+
+	if _, err := prog.Eval(map[string]float64{"x": 1}); err == nil {
+		t.Fatalf("expected error for unbound variable")
+	}
+	if _, err := Compile("1+"); err == nil {
+		t.Fatalf("expected compile error")
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	compiles := 0
+	c.compile = func(expr string) (*Program, error) {
+		compiles++
+		return Compile(expr)
+	}
+
+	for i, x := range []float64{1, 2, 3} {
+		got, err := c.Eval("x+1", map[string]float64{"x": x})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != x+1 {
+			t.Fatalf("wrong result on call %d: got %v want %v", i, got, x+1)
+		}
+	}
+	if compiles != 1 {
+		t.Fatalf("expected one compile for a repeated expression, got %d", compiles)
+	}
+
+	c.Eval("x*2", map[string]float64{"x": 1})
+	c.Eval("x+1", map[string]float64{"x": 1})
+	c.Eval("x-1", map[string]float64{"x": 1})
+	if c.Len() != 2 {
+		t.Fatalf("wrong length: got %d want 2", c.Len())
+	}
+	c.Eval("x+1", map[string]float64{"x": 1})
+	if compiles != 3 {
+		t.Fatalf("recently used entry should survive eviction, got %d compiles", compiles)
+	}
+	c.Eval("x*2", map[string]float64{"x": 1})
+	if compiles != 4 {
+		t.Fatalf("least recently used entry should be evicted, got %d compiles", compiles)
+	}
+
+	if _, err := c.Eval("2*", nil); err == nil {
+		t.Fatalf("expected compile error")
+	}
+	if c.Len() != 2 {
+		t.Fatalf("failed compiles should not be cached, got %d entries", c.Len())
+	}
+
+	c.Purge()
+	if c.Len() != 0 {
+		t.Fatalf("Purge left %d entries", c.Len())
+	}
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	c := NewCache(4)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			x := float64(i)
+			if got, err := c.Eval("x*x", map[string]float64{"x": x}); err != nil || got != x*x {
+				t.Errorf("wrong result for x=%v: got %v, %v", x, got, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
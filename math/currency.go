@@ -0,0 +1,54 @@
+package math
+
+import (
+	"fmt"
+	"strings"
+)
+
+// currencyDecimals maps ISO 4217 codes to the number of minor-unit digits.
+var currencyDecimals = map[string]int{
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CHF": 2,
+	"CAD": 2,
+	"AUD": 2,
+	"CNY": 2,
+	"INR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+}
+
+// Money is an amount in a currency's minor units.
+type Money struct {
+	Cents    int64
+	Currency string
+}
+
+// String formats the amount with the currency's decimal count followed by
+// its code, e.g. "12.50 USD" or "1000 JPY".
+func (m Money) String() string {
+	decimals, ok := currencyDecimals[m.Currency]
+	if !ok {
+		decimals = moneyDecimals
+	}
+	return FormatCents(m.Cents, decimals) + " " + m.Currency
+}
+
+// EvalMoney evaluates expr in the minor units of currency, an ISO 4217 code
+// such as "USD" or "JPY", and returns the amount tagged with that code.
+func EvalMoney(expr string, currency string) (Money, error) {
+	code := strings.ToUpper(currency)
+	decimals, ok := currencyDecimals[code]
+	if !ok {
+		return Money{}, fmt.Errorf("unknown currency %q", currency)
+	}
+	cents, err := EvalMoneyExpressionScale(expr, decimals)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Cents: cents, Currency: code}, nil
+}
@@ -0,0 +1,37 @@
+package math
+
+import "testing"
+
+func TestEvalMoney(t *testing.T) {
+	cases := []struct {
+		expr     string
+		currency string
+		want     Money
+		str      string
+	}{
+		{"12.50*2", "USD", Money{Cents: 2500, Currency: "USD"}, "25.00 USD"},
+		{"-12.50", "eur", Money{Cents: -1250, Currency: "EUR"}, "-12.50 EUR"},
+		{"1000/3", "JPY", Money{Cents: 333, Currency: "JPY"}, "333 JPY"},
+		{"1.234+1", "KWD", Money{Cents: 2234, Currency: "KWD"}, "2.234 KWD"},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoney(tc.expr, tc.currency)
+		if err != nil {
+			t.Fatalf("unexpected error for %q in %s: %v", tc.expr, tc.currency, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q in %s: got %+v want %+v", tc.expr, tc.currency, got, tc.want)
+		}
+		if got.String() != tc.str {
+			t.Fatalf("wrong string for %q in %s: got %q want %q", tc.expr, tc.currency, got.String(), tc.str)
+		}
+	}
+
+	if _, err := EvalMoney("1", "XYZ"); err == nil {
+		t.Fatalf("expected error for unknown currency")
+	}
+	if _, err := EvalMoney("1.5", "JPY"); err == nil {
+		t.Fatalf("expected error for fractional yen")
+	}
+}
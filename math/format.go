@@ -0,0 +1,168 @@
+package math
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// FormatPercent renders a ratio as a percentage, so 0.1234 with two
+// decimals becomes "12.34%".
+func FormatPercent(v float64, decimals int) string {
+	return strconv.FormatFloat(v*100, 'f', decimals, 64) + "%"
+}
+
+// Format parses expr and re-emits it in canonical form: no spaces around
+// operators and parentheses only where precedence or associativity needs
+// them, so "((2+3))*4" becomes "(2+3)*4".
+func Format(expr string) (string, error) {
+	e, err := Parse(expr)
+	if err != nil {
+		return "", err
+	}
+	return e.String(), nil
+}
+
+// FormatAuto renders v in plain decimal notation when its magnitude is in
+// [minFixed, maxFixed) and in scientific notation otherwise, so 1e21 prints
+// as "1e+21" rather than a long run of zeros. Zero is always "0".
+func FormatAuto(v, minFixed, maxFixed float64) string {
+	if a := math.Abs(v); v != 0 && (a < minFixed || a >= maxFixed) {
+		return strconv.FormatFloat(v, 'e', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// FormatMode selects what FormatOptions.Precision counts.
+type FormatMode int
+
+const (
+	// FixedDecimals counts digits after the decimal point.
+	FixedDecimals FormatMode = iota
+	// SignificantDigits counts digits from the first non-zero one.
+	SignificantDigits
+)
+
+// FormatOptions controls FormatResult.
+type FormatOptions struct {
+	// Precision is the number of digits kept, as counted by Mode. A
+	// negative Precision keeps as many as needed to round-trip the value.
+	Precision int
+	Mode      FormatMode
+
+	// TrimTrailingZeros drops zeros at the end of the fractional part, and
+	// the decimal point if nothing is left after it, so "2.5000" becomes
+	// "2.5" and "3.00" becomes "3".
+	TrimTrailingZeros bool
+}
+
+// FormatResult renders v in plain decimal notation according to opts.
+// NaN and infinities are written as "NaN", "+Inf" and "-Inf".
+func FormatResult(v float64, opts FormatOptions) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	var s string
+	switch {
+	case opts.Precision < 0:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case opts.Mode == SignificantDigits && v != 0:
+		digits := max(opts.Precision, 1)
+		// Round in scientific notation first, since the exponent of the
+		// rounded value decides how many decimals remain.
+		e := strconv.FormatFloat(v, 'e', digits-1, 64)
+		exp, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:])
+		rounded, _ := strconv.ParseFloat(e, 64)
+		s = strconv.FormatFloat(rounded, 'f', max(digits-1-exp, 0), 64)
+	case opts.Mode == SignificantDigits:
+		s = strconv.FormatFloat(0, 'f', max(opts.Precision-1, 0), 64)
+	default:
+		s = strconv.FormatFloat(v, 'f', opts.Precision, 64)
+	}
+
+	if opts.TrimTrailingZeros && strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// EvalExpressionDisplay evaluates expr at full precision and also returns
+// the result rounded to sigfigs significant digits for display.
+func EvalExpressionDisplay(expr string, sigfigs int) (float64, string, error) {
+	if sigfigs <= 0 {
+		return 0, "", fmt.Errorf("significant digits must be positive, got %d", sigfigs)
+	}
+	v, err := EvalExpression(expr)
+	if err != nil {
+		return 0, "", err
+	}
+	return v, strconv.FormatFloat(v, 'g', sigfigs, 64), nil
+}
+
+// maxRepeatingDenominator bounds the fractions FormatRepeating tries when
+// recovering a rational form from a float.
+const maxRepeatingDenominator = 1_000_000
+
+// FormatRepeating rounds v to maxDecimals decimal places. If v looks like a
+// fraction with a repeating decimal expansion, such as 1/3, an ellipsis is
+// appended ("0.333..."); otherwise trailing zeros are dropped ("0.25").
+// With maxDecimals <= 0 no digits after the point are shown, so v is
+// rounded to an integer without an ellipsis.
+func FormatRepeating(v float64, maxDecimals int) string {
+	if maxDecimals <= 0 {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	s := strconv.FormatFloat(v, 'f', maxDecimals, 64)
+	if r, ok := simpleRat(v); ok && repeats(r) {
+		return s + "..."
+	}
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// simpleRat finds the fraction with the smallest denominator, up to
+// maxRepeatingDenominator, that matches v to within a few ulps.
+func simpleRat(v float64) (*big.Rat, bool) {
+	if math.IsNaN(v) || math.IsInf(v, 0) || math.Abs(v) > 1e15 {
+		return nil, false
+	}
+	tol := 4e-16 * math.Max(1, math.Abs(v))
+	h0, h1 := int64(0), int64(1)
+	k0, k1 := int64(1), int64(0)
+	x := v
+	for i := 0; i < 64; i++ {
+		a := math.Floor(x)
+		h0, h1 = h1, int64(a)*h1+h0
+		k0, k1 = k1, int64(a)*k1+k0
+		if k1 > maxRepeatingDenominator {
+			return nil, false
+		}
+		if math.Abs(float64(h1)/float64(k1)-v) <= tol {
+			return big.NewRat(h1, k1), true
+		}
+		if x == a {
+			break
+		}
+		x = 1 / (x - a)
+	}
+	return nil, false
+}
+
+// repeats reports whether r has an infinite decimal expansion, that is
+// whether its reduced denominator has a prime factor other than 2 or 5.
+func repeats(r *big.Rat) bool {
+	d := new(big.Int).Set(r.Denom())
+	two, five := big.NewInt(2), big.NewInt(5)
+	mod := new(big.Int)
+	for _, p := range []*big.Int{two, five} {
+		for d.Cmp(big.NewInt(1)) != 0 && mod.Mod(d, p).Sign() == 0 {
+			d.Quo(d, p)
+		}
+	}
+	return d.Cmp(big.NewInt(1)) != 0
+}
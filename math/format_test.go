@@ -0,0 +1,187 @@
+package math
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormatPercent(t *testing.T) {
+	cases := []struct {
+		v        float64
+		decimals int
+		want     string
+	}{
+		{0.1234, 2, "12.34%"},
+		{-0.5, 2, "-50.00%"},
+		{1, 0, "100%"},
+		{0.00125, 3, "0.125%"},
+	}
+
+	for _, tc := range cases {
+		if got := FormatPercent(tc.v, tc.decimals); got != tc.want {
+			t.Fatalf("FormatPercent(%v, %d) = %q, want %q", tc.v, tc.decimals, got, tc.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"((2+3))*4", "(2+3)*4"},
+		{"2 + 3 + 4", "2+3+4"},
+		{"(2+3)+4", "2+3+4"},
+		{"2+(3+4)", "2+(3+4)"},
+		{"2-(3-4)", "2-(3-4)"},
+		{"(2-3)-4", "2-3-4"},
+		{"2^(3^2)", "2^3^2"},
+		{"(2^3)^2", "(2^3)^2"},
+		{"-(3+4)", "-(3+4)"},
+		{"-(3+4)*2", "-(3+4)*2"},
+		{"2*(-3)", "2*-3"},
+		{"--5", "--5"},
+		{"(-2)^2", "(-2)^2"},
+		{"-(2^2)", "-2^2"},
+		{"2^(-3)", "2^-3"},
+		{"max( 1 ,2*(3) )", "max(1, 2*3)"},
+		{"(1>0) ? (5) : (6)", "1>0?5:6"},
+		{"(1?2:3)?4:5", "(1?2:3)?4:5"},
+		{"!(1 && 0)", "!(1&&0)"},
+	}
+
+	for _, tc := range cases {
+		got, err := Format(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("Format(%q) = %q, want %q", tc.expr, got, tc.want)
+		}
+	}
+
+	if _, err := Format("(2+3"); err == nil {
+		t.Fatalf("expected error for unbalanced input")
+	}
+}
+
+func TestFormatResult(t *testing.T) {
+	fixed4 := FormatOptions{Precision: 4}
+	sig3 := FormatOptions{Precision: 3, Mode: SignificantDigits}
+	trim := func(o FormatOptions) FormatOptions {
+		o.TrimTrailingZeros = true
+		return o
+	}
+
+	cases := []struct {
+		v    float64
+		opts FormatOptions
+		want string
+	}{
+		{1.0 / 3, fixed4, "0.3333"},
+		{2.5, fixed4, "2.5000"},
+		{2.5, trim(fixed4), "2.5"},
+		{0.1, FormatOptions{Precision: 2}, "0.10"},
+		{0.1, FormatOptions{Precision: 2, TrimTrailingZeros: true}, "0.1"},
+		{3, trim(fixed4), "3"},
+		{120, FormatOptions{Precision: 0}, "120"},
+		{1.0 / 3, sig3, "0.333"},
+		{123456, sig3, "123000"},
+		{0.00012345, sig3, "0.000123"},
+		{9.996, sig3, "10.0"},
+		{9.996, trim(sig3), "10"},
+		{2.5, FormatOptions{Precision: 5, Mode: SignificantDigits}, "2.5000"},
+		{0, sig3, "0.00"},
+		{-1.0 / 3, sig3, "-0.333"},
+		{1.0 / 3, FormatOptions{Precision: -1}, "0.3333333333333333"},
+		{math.Inf(-1), fixed4, "-Inf"},
+	}
+
+	for _, tc := range cases {
+		if got := FormatResult(tc.v, tc.opts); got != tc.want {
+			t.Fatalf("FormatResult(%v, %+v) = %q, want %q", tc.v, tc.opts, got, tc.want)
+		}
+	}
+}
+
+func TestEvalExpressionDisplay(t *testing.T) {
+	cases := []struct {
+		expr    string
+		sigfigs int
+		want    string
+	}{
+		{"1/3", 6, "0.333333"},
+		{"2/3", 3, "0.667"},
+		{"100/8", 10, "12.5"},
+		{"pi", 4, "3.142"},
+	}
+
+	for _, tc := range cases {
+		v, display, err := EvalExpressionDisplay(tc.expr, tc.sigfigs)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if display != tc.want {
+			t.Fatalf("wrong display for %q: got %q want %q", tc.expr, display, tc.want)
+		}
+		if full, _ := EvalExpression(tc.expr); v != full {
+			t.Fatalf("value for %q lost precision: got %v want %v", tc.expr, v, full)
+		}
+	}
+
+	if _, _, err := EvalExpressionDisplay("1/3", 0); err == nil {
+		t.Fatalf("expected error for zero significant digits")
+	}
+}
+
+func TestFormatRepeating(t *testing.T) {
+	cases := []struct {
+		expr     string
+		decimals int
+		want     string
+	}{
+		{"1/3", 3, "0.333..."},
+		{"1/4", 3, "0.25"},
+		{"2/3", 3, "0.667..."},
+		{"1/7", 6, "0.142857..."},
+		{"-5/6", 2, "-0.83..."},
+		{"22/7", 2, "3.14..."},
+		{"3", 2, "3"},
+		{"1/8", 5, "0.125"},
+		{"pi", 4, "3.1416"},
+		{"1/3", 0, "0"},
+		{"5/3", 0, "2"},
+		{"5/3", -1, "2"},
+	}
+
+	for _, tc := range cases {
+		v, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got := FormatRepeating(v, tc.decimals); got != tc.want {
+			t.Fatalf("FormatRepeating(%s, %d) = %q, want %q", tc.expr, tc.decimals, got, tc.want)
+		}
+	}
+}
+
+func TestFormatAuto(t *testing.T) {
+	cases := []struct {
+		v    float64
+		want string
+	}{
+		{0, "0"},
+		{1234.5, "1234.5"},
+		{-0.25, "-0.25"},
+		{1e21, "1e+21"},
+		{-3.5e15, "-3.5e+15"},
+		{1e-7, "1e-07"},
+		{0.000001, "0.000001"},
+	}
+
+	for _, tc := range cases {
+		if got := FormatAuto(tc.v, 1e-6, 1e15); got != tc.want {
+			t.Fatalf("FormatAuto(%v) = %q, want %q", tc.v, got, tc.want)
+		}
+	}
+}
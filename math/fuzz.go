@@ -0,0 +1,79 @@
+package math
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+var (
+	fuzzBinaryOps = []string{"+", "-", "*", "/", "^", "%"}
+	fuzzUnaryFns  = []string{"abs", "sqrt", "floor", "ceil", "round", "sin", "cos", "exp"}
+	fuzzNaryFns   = []string{"min", "max", "sum", "avg"}
+)
+
+// FuzzEval generates a random valid expression from seed, nesting at most
+// maxDepth levels, and returns it with its value. The same seed always
+// yields the same expression. The value is NaN if evaluation fails, which
+// would point to a gap between the generator and the parser.
+func FuzzEval(seed int64, maxDepth int) (expr string, value float64) {
+	r := rand.New(rand.NewSource(seed))
+	var b strings.Builder
+	genExpr(r, &b, maxDepth)
+	expr = b.String()
+
+	v, err := EvalExpression(expr)
+	if err != nil {
+		return expr, math.NaN()
+	}
+	return expr, v
+}
+
+func genExpr(r *rand.Rand, b *strings.Builder, depth int) {
+	if depth <= 0 {
+		genNumber(r, b)
+		return
+	}
+
+	switch r.Intn(5) {
+	case 0:
+		genNumber(r, b)
+	case 1:
+		b.WriteString("-")
+		genExpr(r, b, depth-1)
+	case 2:
+		b.WriteString(fuzzUnaryFns[r.Intn(len(fuzzUnaryFns))])
+		b.WriteString("(")
+		genExpr(r, b, depth-1)
+		b.WriteString(")")
+	case 3:
+		b.WriteString(fuzzNaryFns[r.Intn(len(fuzzNaryFns))])
+		b.WriteString("(")
+		n := 2 + r.Intn(3)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			genExpr(r, b, depth-1)
+		}
+		b.WriteString(")")
+	default:
+		b.WriteString("(")
+		genExpr(r, b, depth-1)
+		b.WriteString(" " + fuzzBinaryOps[r.Intn(len(fuzzBinaryOps))] + " ")
+		genExpr(r, b, depth-1)
+		b.WriteString(")")
+	}
+}
+
+func genNumber(r *rand.Rand, b *strings.Builder) {
+	switch r.Intn(4) {
+	case 0:
+		b.WriteString(strconv.FormatFloat(float64(r.Intn(1000))/10, 'f', -1, 64))
+	case 1:
+		b.WriteString([]string{"pi", "e"}[r.Intn(2)])
+	default:
+		b.WriteString(strconv.Itoa(r.Intn(100)))
+	}
+}
@@ -0,0 +1,23 @@
+package math
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFuzzEval(t *testing.T) {
+	for seed := int64(0); seed < 500; seed++ {
+		expr, v := FuzzEval(seed, 5)
+		if _, err := EvalExpression(expr); err != nil {
+			t.Fatalf("seed %d generated invalid expression %q: %v", seed, expr, err)
+		}
+		again, w := FuzzEval(seed, 5)
+		if again != expr || !(v == w || math.IsNaN(v) && math.IsNaN(w)) {
+			t.Fatalf("seed %d is not deterministic: %q=%v vs %q=%v", seed, expr, v, again, w)
+		}
+	}
+
+	if expr, _ := FuzzEval(1, 0); expr == "" {
+		t.Fatalf("depth 0 should still produce a number")
+	}
+}
@@ -0,0 +1,23 @@
+// Package gocaltest provides helpers for testing formulas evaluated with
+// the gocal math package.
+package gocaltest
+
+import (
+	"testing"
+
+	"github.com/orayew2002/gocal/math"
+)
+
+// AssertEval evaluates expr with math.EvalExpression and reports a test
+// error when it fails or when the result is not within eps of want.
+func AssertEval(t testing.TB, expr string, want, eps float64) {
+	t.Helper()
+	got, err := math.EvalExpression(expr)
+	if err != nil {
+		t.Errorf("evaluating %q: %v", expr, err)
+		return
+	}
+	if !math.EqualWithin(got, want, eps) {
+		t.Errorf("%q = %v, want %v (±%v)", expr, got, want, eps)
+	}
+}
@@ -0,0 +1,44 @@
+package gocaltest
+
+import (
+	"fmt"
+	"testing"
+)
+
+// recorder captures failures instead of failing the enclosing test.
+type recorder struct {
+	testing.TB
+	msgs []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.msgs = append(r.msgs, fmt.Sprintf(format, args...))
+}
+
+func TestAssertEval(t *testing.T) {
+	AssertEval(t, "tau/2", 3.14159265, 1e-8)
+
+	cases := []struct {
+		expr string
+		want float64
+		msg  string
+	}{
+		{"2+2", 4, ""},
+		{"1/3", 0.33, `"1/3" = 0.3333333333333333, want 0.33 (±0.001)`},
+		{"2+", 0, `evaluating "2+": expression ends with an operator "+" at line 1, column 2`},
+	}
+
+	for _, tc := range cases {
+		r := &recorder{TB: t}
+		AssertEval(r, tc.expr, tc.want, 1e-3)
+		got := ""
+		if len(r.msgs) > 0 {
+			got = r.msgs[0]
+		}
+		if got != tc.msg {
+			t.Fatalf("wrong message for %q: got %q want %q", tc.expr, got, tc.msg)
+		}
+	}
+}
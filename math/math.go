@@ -1,37 +1,242 @@
 package math
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 )
 
+// TokenType classifies a Token.
 type TokenType int
 
 const (
-	TNumber TokenType = iota
-	TOp
-	TFunc
-	TComma
-	TLParen
-	TRParen
+	TNumber  TokenType = iota // numeric literal or named constant
+	TOp                       // operator, including unary NEG/POS after toRPN
+	TFunc                     // function name
+	TComma                    // function argument separator
+	TLParen                   // opening parenthesis
+	TRParen                   // closing parenthesis
+	TPercent                  // postfix-percent literal such as "50%"
+	TVar                      // variable reference, produced by toRPN
 )
 
+var tokenTypeStrings = [...]string{
+	TNumber:  "Number",
+	TOp:      "Op",
+	TFunc:    "Func",
+	TComma:   "Comma",
+	TLParen:  "LParen",
+	TRParen:  "RParen",
+	TPercent: "Percent",
+	TVar:     "Var",
+}
+
+func (t TokenType) String() string {
+	if t < 0 || int(t) >= len(tokenTypeStrings) {
+		return fmt.Sprintf("TokenType(%d)", int(t))
+	}
+	return tokenTypeStrings[t]
+}
+
+// MarshalText encodes t by its lowercased String name, such as "number"
+// or "op".
+func (t TokenType) MarshalText() ([]byte, error) {
+	if t < 0 || int(t) >= len(tokenTypeStrings) {
+		return nil, fmt.Errorf("unknown token type %d", int(t))
+	}
+	return []byte(strings.ToLower(tokenTypeStrings[t])), nil
+}
+
+// UnmarshalText decodes a name produced by MarshalText.
+func (t *TokenType) UnmarshalText(text []byte) error {
+	for i, name := range tokenTypeStrings {
+		if strings.ToLower(name) == string(text) {
+			*t = TokenType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown token type %q", text)
+}
+
 type Token struct {
 	Typ   TokenType
 	Text  string
 	Value float64
 	Arity int
+	Pos   int
+	Line  int
+	Col   int
+}
+
+// String renders the token as its type and text, such as Number(2), with
+// the arity added for functions: Func(max/2).
+func (t Token) String() string {
+	if t.Typ == TFunc {
+		return fmt.Sprintf("%s(%s/%d)", t.Typ, t.Text, t.Arity)
+	}
+	return fmt.Sprintf("%s(%s)", t.Typ, t.Text)
 }
 
-func tokenize(s string) ([]Token, error) {
-	var tokens []Token
+// Options tunes how expressions are parsed and evaluated. The zero value
+// matches EvalExpression.
+type Options struct {
+	// PostfixPercent makes a number immediately followed by "%" (as in
+	// "50%" or "10% * 200") a percent literal worth a hundredth of its
+	// value. When an operand follows the "%", as in "50 % 2" or "50%2",
+	// it stays the binary percent operator, where a%b is b percent of a.
+	// Percent literals add and subtract as plain fractions, so "5% - 3%"
+	// is 0.02, two percentage points.
+	PostfixPercent bool
+
+	// PercentOfSum gives percent literals desktop-calculator meaning when
+	// they are added or subtracted: "200+10%" is 220 and "200-10%" is 180.
+	// When both sides are percent literals they are percentage points, so
+	// "5% - 3%" is still 0.02. It implies PostfixPercent.
+	PercentOfSum bool
+
+	// Vars binds bare identifiers to values. Names are matched
+	// case-insensitively, like every identifier. When nil, an identifier
+	// that is not a constant must be a function call.
+	Vars map[string]float64
+
+	// MaxArgs caps the number of arguments in a single function call.
+	// Zero means defaultMaxArgs.
+	MaxArgs int
+
+	// MaxTokens rejects expressions with more tokens than this. Zero means
+	// unlimited.
+	MaxTokens int
+
+	// Costs assigns a cost to operators and functions by name (unary
+	// minus and plus are "NEG" and "POS"). Anything not listed costs 1.
+	Costs map[string]int
+
+	// MaxCost rejects expressions whose total operator and function cost
+	// exceeds it. Zero means unlimited.
+	MaxCost int
+
+	// ResultTransform, if set, is applied to the final result.
+	ResultTransform func(float64) float64
+
+	// NaNReplacement, if set, replaces any NaN produced by an operator or
+	// function during evaluation.
+	NaNReplacement *float64
+
+	// ErrorOnNaN and ErrorOnInf turn a final NaN or ±Inf result into an
+	// error instead of returning it.
+	ErrorOnNaN bool
+	ErrorOnInf bool
+
+	// ResolveCall is consulted for function names the evaluator does not
+	// know. It reports ok=false to fall through to the usual error.
+	ResolveCall func(name string, args []float64) (float64, bool, error)
+
+	// Funcs registers custom functions by name. Built-in functions take
+	// precedence, and Funcs is consulted before ResolveCall.
+	Funcs map[string]Func
+
+	// FuncTimeout bounds each call to a function in Funcs. The context
+	// passed to the function is cancelled once it elapses. Zero means the
+	// call only ends with the evaluation context.
+	FuncTimeout time.Duration
+
+	// SnapIntegerTolerance, if positive, rounds a final result that lies
+	// within this distance of an integer to that integer, so 4.999999999
+	// becomes 5. It is applied before ResultTransform.
+	SnapIntegerTolerance float64
+
+	// OctalLeadingZero reads integers written with a leading zero, such as
+	// "017", or with a "0o" prefix, such as "0o17", as octal. Without it
+	// "017" is decimal 17. A leading-zero number with a fraction or
+	// exponent, such as "017.5", is always decimal.
+	OctalLeadingZero bool
+
+	// ImplicitMultiplication reads a number or closing parenthesis directly
+	// followed by an identifier, constant or opening parenthesis as a
+	// product, so "2x" is 2*x, "2pi" is 2*pi and "2(3+1)" is 8.
+	ImplicitMultiplication bool
+
+	// SafeMode hardens evaluation of untrusted input: the inf and nan
+	// constants are rejected, and so is a NaN or infinite result.
+	SafeMode bool
+
+	// MaxDepth rejects expressions whose parentheses, including function
+	// calls, nest deeper than this. Zero means unlimited.
+	MaxDepth int
+
+	// MaxExponent, if positive, rejects "^" and pow with an exponent whose
+	// absolute value exceeds it.
+	MaxExponent float64
+
+	// PowerLeftAssoc makes "^" left-associative, so 2^3^2 is (2^3)^2 = 64
+	// as on some legacy calculators, instead of 2^(3^2) = 512.
+	PowerLeftAssoc bool
+
+	// Unary selects whether unary signs bind tighter or looser than "^".
+	Unary UnaryPrecedence
+
+	// trace, if set, is called after each RPN token is evaluated with the
+	// resulting stack.
+	trace func(t Token, stack []float64)
+}
+
+// UnaryPrecedence selects how unary "-" and "+" bind relative to "^".
+// Either way they bind tighter than "*" and "/".
+type UnaryPrecedence int
+
+const (
+	// UnaryDefault is UnaryBelowPower, the mathematical convention.
+	UnaryDefault UnaryPrecedence = iota
+	// UnaryAbovePower applies the sign first: -2^2 is (-2)^2 = 4.
+	UnaryAbovePower
+	// UnaryBelowPower applies the power first: -2^2 is -(2^2) = -4.
+	UnaryBelowPower
+)
+
+// Func is a custom function registered through Options.Funcs. It should
+// return promptly once ctx is done.
+type Func func(ctx context.Context, args []float64) (float64, error)
+
+const defaultMaxArgs = 10000
+
+// ErrTrailingOperator is returned, wrapped with the operator and its
+// position, when an expression ends with an operator, as in "2+".
+var ErrTrailingOperator = errors.New("expression ends with an operator")
+
+// multiResultFuncs push more than one value. The extra values are meant to
+// be consumed by a trailing binary operator, as in "minmax(1,5,3) -".
+var multiResultFuncs = map[string]bool{
+	"minmax": true,
+}
+
+func isBinaryOp(op string) bool {
+	switch op {
+	case "NEG", "POS", "NOT", "!", "?", ":":
+		return false
+	}
+	return true
+}
+
+func tokenize(s string, opts Options) ([]Token, error) {
+	return tokenizeInto(nil, s, opts)
+}
+
+// tokenizeInto is tokenize appending to tokens, so callers can reuse a
+// buffer.
+func tokenizeInto(tokens []Token, s string, opts Options) ([]Token, error) {
 	i := 0
 
 	for i < len(s) {
+		if opts.MaxTokens > 0 && len(tokens) > opts.MaxTokens {
+			return nil, errors.New("expression too large")
+		}
+
 		r := rune(s[i])
 
 		if unicode.IsSpace(r) {
@@ -40,27 +245,37 @@ func tokenize(s string) ([]Token, error) {
 		}
 
 		if s[i] == ',' {
-			tokens = append(tokens, Token{Typ: TComma, Text: ","})
+			tokens = append(tokens, Token{Typ: TComma, Text: ",", Pos: i})
 			i++
 			continue
 		}
 		if s[i] == '(' {
-			tokens = append(tokens, Token{Typ: TLParen, Text: "("})
+			tokens = append(tokens, Token{Typ: TLParen, Text: "(", Pos: i})
 			i++
 			continue
 		}
 		if s[i] == ')' {
-			tokens = append(tokens, Token{Typ: TRParen, Text: ")"})
+			tokens = append(tokens, Token{Typ: TRParen, Text: ")", Pos: i})
 			i++
 			continue
 		}
 
+		if i+1 < len(s) && isTwoCharOp(s[i:i+2]) {
+			tokens = append(tokens, Token{Typ: TOp, Text: s[i : i+2], Pos: i})
+			i += 2
+			continue
+		}
+
 		if isOpByte(s[i]) {
-			tokens = append(tokens, Token{Typ: TOp, Text: string(s[i])})
+			tokens = append(tokens, Token{Typ: TOp, Text: string(s[i]), Pos: i})
 			i++
 			continue
 		}
 
+		if s[i] == '_' && i+1 < len(s) && isDigit(s[i+1]) {
+			return nil, errorAt(s, i, "invalid number near %q", s[i:i+2])
+		}
+
 		if isIdentStart(s[i]) {
 			start := i
 			i++
@@ -68,14 +283,42 @@ func tokenize(s string) ([]Token, error) {
 				i++
 			}
 			name := strings.ToLower(s[start:i])
+			if opts.SafeMode && unsafeConstants[name] {
+				return nil, errorAt(s, start, "constant %q is not allowed in safe mode", name)
+			}
 			if val, ok := constants[name]; ok {
-				tokens = append(tokens, Token{Typ: TNumber, Text: name, Value: val})
+				tokens = append(tokens, Token{Typ: TNumber, Text: name, Value: val, Pos: start})
 			} else {
-				tokens = append(tokens, Token{Typ: TFunc, Text: name})
+				tokens = append(tokens, Token{Typ: TFunc, Text: name, Pos: start})
 			}
 			continue
 		}
 
+		if opts.OctalLeadingZero && isOctalStart(s, i) {
+			start, digitStart := i, i
+			i++
+			if s[i] == 'o' || s[i] == 'O' {
+				i++
+				digitStart = i
+			}
+			for i < len(s) && (isDigit(s[i]) || s[i] == '_') {
+				if s[i] == '_' && (i == digitStart || !validSeparator(s, i)) {
+					return nil, errorAt(s, start, "invalid number near %q", s[start:i+1])
+				}
+				i++
+			}
+			txt := s[start:i]
+			if i < len(s) && (s[i] == '.' || isIdentStart(s[i])) {
+				return nil, errorAt(s, start, "invalid octal number near %q", s[start:i+1])
+			}
+			n, err := strconv.ParseUint(strings.ReplaceAll(s[digitStart:i], "_", ""), 8, 64)
+			if err != nil {
+				return nil, errorAt(s, start, "invalid octal number %q", txt)
+			}
+			tokens = append(tokens, Token{Typ: TNumber, Text: txt, Value: float64(n), Pos: start})
+			continue
+		}
+
 		if isNumStart(s, i) {
 			start := i
 			dotCount := 0
@@ -86,7 +329,7 @@ func tokenize(s string) ([]Token, error) {
 				if c == '.' {
 					dotCount++
 					if dotCount > 1 {
-						return nil, fmt.Errorf("invalid number near %q", s[start:i+1])
+						return nil, errorAt(s, start, "invalid number near %q", s[start:i+1])
 					}
 					i++
 					continue
@@ -96,17 +339,27 @@ func tokenize(s string) ([]Token, error) {
 					i++
 					continue
 				}
+				if c == '_' {
+					if !validSeparator(s, i) {
+						return nil, errorAt(s, start, "invalid number near %q", s[start:i+1])
+					}
+					i++
+					continue
+				}
 				if (c == 'e' || c == 'E') && hasDigits {
 					i++
 					if i < len(s) && (s[i] == '+' || s[i] == '-') {
 						i++
 					}
 					expStart := i
-					for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+					for i < len(s) && (isDigit(s[i]) || s[i] == '_') {
+						if s[i] == '_' && (i == expStart || !validSeparator(s, i)) {
+							return nil, errorAt(s, start, "invalid number near %q", s[start:i+1])
+						}
 						i++
 					}
 					if expStart == i {
-						return nil, fmt.Errorf("invalid exponent in number near %q", s[start:i])
+						return nil, errorAt(s, start, "invalid exponent in number near %q", s[start:i])
 					}
 					break
 				}
@@ -114,23 +367,71 @@ func tokenize(s string) ([]Token, error) {
 			}
 
 			txt := s[start:i]
-			val, err := strconv.ParseFloat(txt, 64)
+			val, err := strconv.ParseFloat(strings.ReplaceAll(txt, "_", ""), 64)
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse number %q: %w", txt, err)
+				return nil, errorAt(s, start, "failed to parse number %q: %w", txt, err)
+			}
+
+			if (opts.PostfixPercent || opts.PercentOfSum) && i < len(s) && s[i] == '%' && !operandFollows(s, i+1) {
+				i++
+				tokens = append(tokens, Token{Typ: TPercent, Text: s[start:i], Value: val / 100, Pos: start})
+				continue
 			}
 
-			tokens = append(tokens, Token{Typ: TNumber, Text: txt, Value: val})
+			tokens = append(tokens, Token{Typ: TNumber, Text: txt, Value: val, Pos: start})
 			continue
 		}
 
-		return nil, fmt.Errorf("unexpected character: %q", string(s[i]))
+		return nil, errorAt(s, i, "unexpected character: %q", string(s[i]))
 	}
 
+	if opts.MaxTokens > 0 && len(tokens) > opts.MaxTokens {
+		return nil, errors.New("expression too large")
+	}
+
+	line, lineStart, scanned := 1, 0, 0
+	for k := range tokens {
+		for ; scanned < tokens[k].Pos; scanned++ {
+			if s[scanned] == '\n' {
+				line++
+				lineStart = scanned + 1
+			}
+		}
+		tokens[k].Line = line
+		tokens[k].Col = tokens[k].Pos - lineStart + 1
+	}
 	return tokens, nil
 }
 
+func lineCol(s string, pos int) (line, col int) {
+	line = 1 + strings.Count(s[:pos], "\n")
+	col = pos - strings.LastIndexByte(s[:pos], '\n')
+	return line, col
+}
+
+func tokenError(t Token, format string, args ...any) error {
+	return fmt.Errorf(format+" at line %d, column %d", append(args, t.Line, t.Col)...)
+}
+
+func errorAt(s string, pos int, format string, args ...any) error {
+	line, col := lineCol(s, pos)
+	return fmt.Errorf(format+" at line %d, column %d", append(args, line, col)...)
+}
+
 func isOpByte(b byte) bool {
-	return b == '+' || b == '-' || b == '*' || b == '/' || b == '^' || b == '%'
+	switch b {
+	case '+', '-', '*', '/', '^', '%', '&', '|', '<', '>', '?', ':', '!':
+		return true
+	}
+	return false
+}
+
+func isTwoCharOp(s string) bool {
+	switch s {
+	case "<<", ">>", "^^", "<=", ">=", "==", "!=", "&&", "||", "//":
+		return true
+	}
+	return false
 }
 
 func isIdentStart(b byte) bool {
@@ -141,6 +442,44 @@ func isIdentContinue(b byte) bool {
 	return isIdentStart(b) || (b >= '0' && b <= '9')
 }
 
+// isOctalStart reports whether s[i:] begins "0o" or "0" followed by
+// digits or "_" separators, the two octal spellings. A leading-zero
+// literal with a fraction or exponent, such as "00.5", stays decimal.
+func isOctalStart(s string, i int) bool {
+	if s[i] != '0' || i+1 >= len(s) {
+		return false
+	}
+	if s[i+1] == 'o' || s[i+1] == 'O' {
+		return i+2 < len(s) && isDigit(s[i+2])
+	}
+	j := i + 1
+	for j < len(s) && (isDigit(s[j]) || s[j] == '_') {
+		j++
+	}
+	if j == i+1 {
+		return false
+	}
+	return j == len(s) || (s[j] != '.' && s[j] != 'e' && s[j] != 'E')
+}
+
+// operandFollows reports whether the next non-space character in s from i
+// starts an operand, which makes an unspaced "10%2" the binary percent
+// operator rather than a percent literal.
+func operandFollows(s string, i int) bool {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i < len(s) && (isDigit(s[i]) || s[i] == '.' || s[i] == '(' || isIdentStart(s[i]))
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func validSeparator(s string, i int) bool {
+	return i > 0 && isDigit(s[i-1]) && i+1 < len(s) && isDigit(s[i+1])
+}
+
 func isNumStart(s string, i int) bool {
 	if i >= len(s) {
 		return false
@@ -154,43 +493,89 @@ func isNumStart(s string, i int) bool {
 	return false
 }
 
+// "^" stays exponentiation so existing expressions keep their meaning;
+// bitwise XOR is spelled "^^" instead.
 func precedence(op string) int {
 	switch op {
-	case "NEG":
-		return 4
-	case "POS":
-		return 4
+	case "NOT":
+		return 14
 	case "^":
+		return 13
+	case "NEG", "POS":
+		return 12
+	case "*", "/", "//", "%":
+		return 11
+	case "+", "-":
+		return 10
+	case "<<", ">>":
+		return 9
+	case "<", "<=", ">", ">=":
+		return 8
+	case "==", "!=":
+		return 7
+	case "&":
+		return 6
+	case "^^":
+		return 5
+	case "|":
+		return 4
+	case "&&":
 		return 3
-	case "*", "/", "%":
+	case "||":
 		return 2
-	case "+", "-":
+	case "?", "?:":
 		return 1
 	default:
 		return 0
 	}
 }
 
+// rpnPrecedence is precedence on a doubled scale, leaving room to lift
+// unary signs just above "^" for UnaryAbovePower.
+func rpnPrecedence(op string, opts Options) int {
+	if opts.Unary == UnaryAbovePower && (op == "NEG" || op == "POS") {
+		return 2*precedence("^") + 1
+	}
+	return 2 * precedence(op)
+}
+
 func rightAssociative(op string) bool {
-	return op == "^" || op == "NEG" || op == "POS"
+	switch op {
+	case "^", "NEG", "POS", "NOT", "?", "?:":
+		return true
+	}
+	return false
 }
 
-func toRPN(tokens []Token) ([]Token, error) {
-	var out []Token
-	var stack []Token
+func toRPN(tokens []Token, opts Options) ([]Token, error) {
+	return toRPNInto(nil, nil, tokens, opts)
+}
+
+// toRPNInto is toRPN appending to out and using stack as scratch space for
+// operators, so callers can reuse both buffers.
+func toRPNInto(out, stack []Token, tokens []Token, opts Options) ([]Token, error) {
+	if opts.ImplicitMultiplication {
+		tokens = insertImplicitMul(tokens)
+	}
 	var prev *Token
 	var funcParen []bool
 	var argCount []int
+	multiEnd := -1
 
 	for i := 0; i < len(tokens); i++ {
 		t := tokens[i]
 
 		switch t.Typ {
-		case TNumber:
+		case TNumber, TPercent:
 			out = append(out, t)
 
 		case TFunc:
 			if i+1 >= len(tokens) || tokens[i+1].Typ != TLParen {
+				if opts.Vars != nil {
+					t.Typ = TVar
+					out = append(out, t)
+					break
+				}
 				return nil, fmt.Errorf("function %q must be called with parentheses", t.Text)
 			}
 			stack = append(stack, t)
@@ -204,8 +589,14 @@ func toRPN(tokens []Token) ([]Token, error) {
 				funcParen = append(funcParen, false)
 				argCount = append(argCount, 0)
 			}
+			if opts.MaxDepth > 0 && len(funcParen) > opts.MaxDepth {
+				return nil, errors.New("expression too deeply nested")
+			}
 
 		case TComma:
+			if prev != nil && (prev.Typ == TComma || prev.Typ == TLParen) {
+				return nil, errors.New("empty function argument")
+			}
 			found := false
 			for len(stack) > 0 {
 				top := stack[len(stack)-1]
@@ -232,17 +623,21 @@ func toRPN(tokens []Token) ([]Token, error) {
 				}
 				out = append(out, top)
 			}
-			if !found {
-				return nil, errors.New("mismatched parentheses")
+			if !found || len(funcParen) == 0 {
+				return nil, tokenError(t, "unmatched ')'")
 			}
-			if len(funcParen) == 0 {
-				return nil, errors.New("mismatched parentheses")
+			if prev != nil && prev.Typ == TComma {
+				return nil, errors.New("empty function argument")
 			}
 			isFuncCall := funcParen[len(funcParen)-1]
 			argc := argCount[len(argCount)-1]
 			funcParen = funcParen[:len(funcParen)-1]
 			argCount = argCount[:len(argCount)-1]
 
+			if !isFuncCall && prev != nil && prev.Typ == TLParen {
+				return nil, errors.New("empty parentheses")
+			}
+
 			if isFuncCall {
 				if prev != nil && prev.Typ == TLParen {
 					argc = 0
@@ -254,8 +649,18 @@ func toRPN(tokens []Token) ([]Token, error) {
 				}
 				fn := stack[len(stack)-1]
 				stack = stack[:len(stack)-1]
+				maxArgs := opts.MaxArgs
+				if maxArgs == 0 {
+					maxArgs = defaultMaxArgs
+				}
+				if argc > maxArgs {
+					return nil, fmt.Errorf("function %q called with %d arguments, limit is %d", fn.Text, argc, maxArgs)
+				}
 				fn.Arity = argc
 				out = append(out, fn)
+				if multiResultFuncs[fn.Text] {
+					multiEnd = i
+				}
 			}
 
 		case TOp:
@@ -268,18 +673,49 @@ func toRPN(tokens []Token) ([]Token, error) {
 				}
 				t.Text = op
 			}
+			if op == "!" {
+				if prev != nil && prev.Typ != TOp && prev.Typ != TLParen && prev.Typ != TComma {
+					return nil, errors.New("'!' must come before its operand")
+				}
+				t.Text = "NOT"
+			}
 
-			for len(stack) > 0 {
+			if op == ":" {
+				found := false
+				for len(stack) > 0 {
+					top := stack[len(stack)-1]
+					if top.Typ != TOp {
+						break
+					}
+					stack = stack[:len(stack)-1]
+					if top.Text == "?" {
+						found = true
+						break
+					}
+					out = append(out, top)
+				}
+				if !found {
+					return nil, errors.New("':' without matching '?'")
+				}
+				t.Text = "?:"
+				stack = append(stack, t)
+				break
+			}
+
+			// A prefix operator has no left operand yet, so it never
+			// completes an operator already on the stack.
+			prefix := t.Text == "NEG" || t.Text == "POS" || t.Text == "NOT"
+			for !prefix && len(stack) > 0 {
 				top := stack[len(stack)-1]
 				if top.Typ != TOp {
 					break
 				}
 
-				p1 := precedence(t.Text)
-				p2 := precedence(top.Text)
+				p1 := rpnPrecedence(t.Text, opts)
+				p2 := rpnPrecedence(top.Text, opts)
 
-				if (rightAssociative(t.Text) && p1 < p2) ||
-					(!rightAssociative(t.Text) && p1 <= p2) {
+				right := rightAssociative(t.Text) && !(opts.PowerLeftAssoc && t.Text == "^")
+				if (right && p1 < p2) || (!right && p1 <= p2) {
 					stack = stack[:len(stack)-1]
 					out = append(out, top)
 					continue
@@ -296,22 +732,105 @@ func toRPN(tokens []Token) ([]Token, error) {
 		prev = &tokens[i]
 	}
 
+	// A multi-result call leaves its own operands, so "minmax(1,5) -" may
+	// end with a binary operator that consumes them.
+	if prev != nil && prev.Typ == TOp && !(multiEnd >= 0 && multiEnd == len(tokens)-2 && isBinaryOp(prev.Text)) {
+		return nil, tokenError(*prev, "%w %q", ErrTrailingOperator, prev.Text)
+	}
+
 	for len(stack) > 0 {
 		top := stack[len(stack)-1]
 		stack = stack[:len(stack)-1]
-		if top.Typ == TLParen || top.Typ == TRParen {
-			return nil, errors.New("mismatched parentheses")
+		if top.Typ == TLParen {
+			return nil, tokenError(top, "unclosed '('")
 		}
 		if top.Typ == TFunc {
 			return nil, errors.New("function call missing parentheses")
 		}
+		if top.Typ == TOp && top.Text == "?" {
+			return nil, errors.New("'?' without matching ':'")
+		}
 		out = append(out, top)
 	}
 
+	if opts.PercentOfSum {
+		for k := 1; k < len(out); k++ {
+			if out[k].Typ != TOp || (out[k].Text != "+" && out[k].Text != "-") || out[k-1].Typ != TPercent {
+				continue
+			}
+			// The right operand is the single percent token, so the left
+			// operand ends at k-2.
+			if k < 2 || out[k-2].Typ != TPercent {
+				out[k].Text += "%"
+			}
+		}
+	}
+
+	if opts.MaxCost > 0 {
+		cost := 0
+		for _, t := range out {
+			if t.Typ != TOp && t.Typ != TFunc {
+				continue
+			}
+			if c, ok := opts.Costs[t.Text]; ok {
+				cost += c
+			} else {
+				cost++
+			}
+		}
+		if cost > opts.MaxCost {
+			return nil, fmt.Errorf("expression cost %d exceeds budget %d", cost, opts.MaxCost)
+		}
+	}
+
 	return out, nil
 }
 
-func evalRPN(rpn []Token) (float64, error) {
+const ctxCheckInterval = 64
+
+// checkVarKeys rejects keys that differ only by case, such as "X" and
+// "x", since identifiers are matched case-insensitively. Lowercase keys,
+// the common case, cost no allocation.
+func checkVarKeys(vars map[string]float64) error {
+	var seen map[string]string
+	for name := range vars {
+		lower := strings.ToLower(name)
+		if lower == name {
+			continue
+		}
+		other, ok := seen[lower]
+		if _, exact := vars[lower]; exact {
+			other, ok = lower, true
+		}
+		if ok {
+			return fmt.Errorf("variables %q and %q differ only by case", min(name, other), max(name, other))
+		}
+		if seen == nil {
+			seen = map[string]string{}
+		}
+		seen[lower] = name
+	}
+	return nil
+}
+
+// lookupVar finds the variable for the lowercase identifier name, trying
+// an exact key first and then keys that differ only by case.
+func lookupVar(vars map[string]float64, name string) (float64, bool) {
+	if v, ok := vars[name]; ok {
+		return v, true
+	}
+	for k, v := range vars {
+		if strings.ToLower(k) == name {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func evalRPN(ctx context.Context, rpn []Token, opts Options) (float64, error) {
+	if err := checkVarKeys(opts.Vars); err != nil {
+		return 0, err
+	}
 	var st []float64
 
 	pop := func() (float64, error) {
@@ -322,6 +841,12 @@ func evalRPN(rpn []Token) (float64, error) {
 		st = st[:len(st)-1]
 		return v, nil
 	}
+	push := func(v float64) {
+		if opts.NaNReplacement != nil && math.IsNaN(v) {
+			v = *opts.NaNReplacement
+		}
+		st = append(st, v)
+	}
 	popN := func(n int) ([]float64, error) {
 		if n < 0 {
 			return nil, errors.New("invalid argument count")
@@ -337,14 +862,28 @@ func evalRPN(rpn []Token) (float64, error) {
 		return vals, nil
 	}
 
-	for _, t := range rpn {
+	for i, t := range rpn {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+
 		switch t.Typ {
-		case TNumber:
+		case TNumber, TPercent:
 			st = append(st, t.Value)
 
+		case TVar:
+			v, ok := lookupVar(opts.Vars, t.Text)
+			if !ok {
+				return 0, fmt.Errorf("undefined variable %q", t.Text)
+			}
+			st = append(st, v)
+
 		case TFunc:
 			switch t.Text {
-			case "sin", "cos", "tan", "asin", "acos", "atan", "sqrt", "abs", "ln", "log", "exp", "floor", "ceil", "round":
+			case "sin", "cos", "tan", "asin", "acos", "atan", "sqrt", "cbrt", "abs", "ln", "log", "exp", "floor", "ceil", "round",
+				"sinh", "cosh", "tanh", "asinh", "acosh", "atanh", "intpart", "fracpart", "trunc", "frac", "deg", "rad":
 				if t.Arity != 1 {
 					return 0, fmt.Errorf("function %q expects 1 argument", t.Text)
 				}
@@ -368,6 +907,8 @@ func evalRPN(rpn []Token) (float64, error) {
 					res = math.Atan(args[0])
 				case "sqrt":
 					res = math.Sqrt(args[0])
+				case "cbrt":
+					res = math.Cbrt(args[0])
 				case "abs":
 					res = math.Abs(args[0])
 				case "ln":
@@ -382,8 +923,28 @@ func evalRPN(rpn []Token) (float64, error) {
 					res = math.Ceil(args[0])
 				case "round":
 					res = math.Round(args[0])
+				case "sinh":
+					res = math.Sinh(args[0])
+				case "cosh":
+					res = math.Cosh(args[0])
+				case "tanh":
+					res = math.Tanh(args[0])
+				case "asinh":
+					res = math.Asinh(args[0])
+				case "acosh":
+					res = math.Acosh(args[0])
+				case "atanh":
+					res = math.Atanh(args[0])
+				case "intpart", "trunc":
+					res = math.Trunc(args[0])
+				case "fracpart", "frac":
+					res = args[0] - math.Trunc(args[0])
+				case "deg":
+					res = args[0] * 180 / math.Pi
+				case "rad":
+					res = args[0] * math.Pi / 180
 				}
-				st = append(st, res)
+				push(res)
 
 			case "min", "max":
 				if t.Arity < 2 {
@@ -405,9 +966,140 @@ func evalRPN(rpn []Token) (float64, error) {
 						}
 					}
 				}
-				st = append(st, res)
+				push(res)
+
+			case "minmax":
+				if t.Arity < 1 {
+					return 0, fmt.Errorf("function %q expects at least 1 argument", t.Text)
+				}
+				args, err := popN(t.Arity)
+				if err != nil {
+					return 0, err
+				}
+				lo, hi := args[0], args[0]
+				for _, v := range args[1:] {
+					lo = math.Min(lo, v)
+					hi = math.Max(hi, v)
+				}
+				push(hi)
+				push(lo)
+
+			case "sum", "avg":
+				if t.Arity < 1 {
+					return 0, fmt.Errorf("function %q expects at least 1 argument", t.Text)
+				}
+				args, err := popN(t.Arity)
+				if err != nil {
+					return 0, err
+				}
+				var total float64
+				for _, v := range args {
+					total += v
+				}
+				if t.Text == "avg" {
+					total /= float64(len(args))
+				}
+				push(total)
+
+			case "wavg":
+				if t.Arity < 2 || t.Arity%2 != 0 {
+					return 0, fmt.Errorf("function %q expects value, weight pairs", t.Text)
+				}
+				args, err := popN(t.Arity)
+				if err != nil {
+					return 0, err
+				}
+				var total, weights float64
+				for i := 0; i < len(args); i += 2 {
+					total += args[i] * args[i+1]
+					weights += args[i+1]
+				}
+				if weights == 0 {
+					return 0, fmt.Errorf("function %q weights sum to zero", t.Text)
+				}
+				push(total / weights)
+
+			case "rmse":
+				if t.Arity < 2 || t.Arity%2 != 0 {
+					return 0, fmt.Errorf("function %q expects prediction, actual pairs", t.Text)
+				}
+				args, err := popN(t.Arity)
+				if err != nil {
+					return 0, err
+				}
+				var sq float64
+				for i := 0; i < len(args); i += 2 {
+					d := args[i] - args[i+1]
+					sq += d * d
+				}
+				push(math.Sqrt(sq / float64(len(args)/2)))
+
+			case "clamp":
+				if t.Arity != 3 {
+					return 0, fmt.Errorf("function %q expects 3 arguments", t.Text)
+				}
+				args, err := popN(3)
+				if err != nil {
+					return 0, err
+				}
+				x, lo, hi := args[0], args[1], args[2]
+				if lo > hi {
+					return 0, fmt.Errorf("function %q: lower bound %v exceeds upper bound %v", t.Text, lo, hi)
+				}
+				push(math.Min(math.Max(x, lo), hi))
+
+			case "gcd", "lcm":
+				if t.Arity != 2 {
+					return 0, fmt.Errorf("function %q expects 2 arguments", t.Text)
+				}
+				args, err := popN(2)
+				if err != nil {
+					return 0, err
+				}
+				if !isInt64(args[0]) || !isInt64(args[1]) {
+					return 0, fmt.Errorf("function %q requires integer arguments", t.Text)
+				}
+				a, b := int64(args[0]), int64(args[1])
+				g := gcd(absUint64(a), absUint64(b))
+				if t.Text == "gcd" {
+					push(float64(g))
+					break
+				}
+				if g == 0 {
+					push(0)
+					break
+				}
+				l, err := mulInt64(a/int64(g), b)
+				if err != nil {
+					return 0, fmt.Errorf("function %q: %w", t.Text, err)
+				}
+				push(math.Abs(float64(l)))
+
+			case "pow", "atan2", "copysign", "hypot":
+				if t.Arity != 2 {
+					return 0, fmt.Errorf("function %q expects 2 arguments", t.Text)
+				}
+				args, err := popN(2)
+				if err != nil {
+					return 0, err
+				}
+				switch t.Text {
+				case "pow":
+					if err := checkExponent(args[1], opts); err != nil {
+						return 0, err
+					}
+					push(math.Pow(args[0], args[1]))
+				case "atan2":
+					push(math.Atan2(args[0], args[1]))
+				case "copysign":
+					push(math.Copysign(args[0], args[1]))
+				case "hypot":
+					push(math.Hypot(args[0], args[1]))
+				}
 
-			case "pow", "atan2":
+			// Unlike C's fmod and math.Mod, the result takes the sign of the
+			// divisor, so a == (a//b)*b + fmod(a, b) as in Python.
+			case "fmod":
 				if t.Arity != 2 {
 					return 0, fmt.Errorf("function %q expects 2 arguments", t.Text)
 				}
@@ -415,11 +1107,33 @@ func evalRPN(rpn []Token) (float64, error) {
 				if err != nil {
 					return 0, err
 				}
-				if t.Text == "pow" {
-					st = append(st, math.Pow(args[0], args[1]))
-				} else {
-					st = append(st, math.Atan2(args[0], args[1]))
+				a, b := args[0], args[1]
+				if b == 0 {
+					return 0, errors.New("division by zero")
 				}
+				push(a - math.Floor(a/b)*b)
+
+			case "root":
+				if t.Arity != 2 {
+					return 0, fmt.Errorf("function %q expects 2 arguments", t.Text)
+				}
+				args, err := popN(2)
+				if err != nil {
+					return 0, err
+				}
+				x, n := args[0], args[1]
+				// Pow(x, 1/3) is inexact even for perfect cubes.
+				if n == 3 {
+					push(math.Cbrt(x))
+					break
+				}
+				// math.Pow returns NaN for a negative base, but odd roots of
+				// negative numbers are real.
+				if x < 0 && n == math.Trunc(n) && math.Mod(n, 2) != 0 {
+					push(-math.Pow(-x, 1/n))
+					break
+				}
+				push(math.Pow(x, 1/n))
 
 			case "logn":
 				if t.Arity != 2 {
@@ -429,9 +1143,35 @@ func evalRPN(rpn []Token) (float64, error) {
 				if err != nil {
 					return 0, err
 				}
-				st = append(st, math.Log(args[0])/math.Log(args[1]))
+				push(math.Log(args[0]) / math.Log(args[1]))
 
 			default:
+				if fn, ok := opts.Funcs[t.Text]; ok {
+					args, err := popN(t.Arity)
+					if err != nil {
+						return 0, err
+					}
+					v, err := callFunc(ctx, fn, args, opts.FuncTimeout)
+					if err != nil {
+						return 0, fmt.Errorf("function %q: %w", t.Text, err)
+					}
+					push(v)
+					break
+				}
+				if opts.ResolveCall != nil {
+					args, err := popN(t.Arity)
+					if err != nil {
+						return 0, err
+					}
+					v, ok, err := opts.ResolveCall(t.Text, args)
+					if err != nil {
+						return 0, err
+					}
+					if ok {
+						push(v)
+						break
+					}
+				}
 				return 0, fmt.Errorf("unknown function: %q", t.Text)
 			}
 
@@ -442,16 +1182,16 @@ func evalRPN(rpn []Token) (float64, error) {
 				if err != nil {
 					return 0, err
 				}
-				st = append(st, -a)
+				push(-a)
 
 			case "POS":
 				a, err := pop()
 				if err != nil {
 					return 0, err
 				}
-				st = append(st, a)
+				push(a)
 
-			case "+", "-", "*", "/", "%", "^":
+			case "+", "-", "*", "/", "//", "%", "^":
 				b, err := pop()
 				if err != nil {
 					return 0, err
@@ -471,12 +1211,149 @@ func evalRPN(rpn []Token) (float64, error) {
 					res = a * b
 				case "/":
 					res = a / b
+				case "//":
+					if b == 0 {
+						return 0, errors.New("division by zero")
+					}
+					res = math.Floor(a / b)
 				case "%":
 					res = a * b / 100
 				case "^":
+					if err := checkExponent(b, opts); err != nil {
+						return 0, err
+					}
 					res = math.Pow(a, b)
 				}
-				st = append(st, res)
+				push(res)
+
+			case "NOT":
+				a, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				push(boolToFloat(a == 0))
+
+			// Both operands are already evaluated in RPN, so && and || do
+			// not short-circuit. That is harmless for pure arithmetic.
+			case "&&", "||":
+				b, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				a, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				if t.Text == "&&" {
+					push(boolToFloat(a != 0 && b != 0))
+				} else {
+					push(boolToFloat(a != 0 || b != 0))
+				}
+
+			case "+%", "-%":
+				b, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				a, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				if t.Text == "+%" {
+					push(a + a*b)
+				} else {
+					push(a - a*b)
+				}
+
+			case "<", "<=", ">", ">=", "==", "!=":
+				b, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				a, err := pop()
+				if err != nil {
+					return 0, err
+				}
+
+				var res bool
+				switch t.Text {
+				case "<":
+					res = a < b
+				case "<=":
+					res = a <= b
+				case ">":
+					res = a > b
+				case ">=":
+					res = a >= b
+				case "==":
+					res = a == b
+				case "!=":
+					res = a != b
+				}
+				push(boolToFloat(res))
+
+			case "?:":
+				b, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				a, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				cond, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				if cond != 0 {
+					push(a)
+				} else {
+					push(b)
+				}
+
+			case "?":
+				return 0, errors.New("'?' without matching ':'")
+
+			case "&", "|", "^^", "<<", ">>":
+				b, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				a, err := pop()
+				if err != nil {
+					return 0, err
+				}
+				x, err := toInt64(t.Text, a)
+				if err != nil {
+					return 0, err
+				}
+				y, err := toInt64(t.Text, b)
+				if err != nil {
+					return 0, err
+				}
+
+				var res int64
+				switch t.Text {
+				case "&":
+					res = x & y
+				case "|":
+					res = x | y
+				case "^^":
+					res = x ^ y
+				case "<<", ">>":
+					if y < 0 {
+						return 0, fmt.Errorf("negative shift count %d", y)
+					}
+					if t.Text == "<<" {
+						res = x << uint64(y)
+						if x != 0 && (y >= 64 || res>>uint64(y) != x) {
+							return 0, &OverflowError{Op: "<<", A: x, B: y}
+						}
+					} else {
+						res = x >> uint64(y)
+					}
+				}
+				push(float64(res))
 
 			default:
 				return 0, fmt.Errorf("unknown operator: %q", t.Text)
@@ -485,6 +1362,10 @@ func evalRPN(rpn []Token) (float64, error) {
 		default:
 			return 0, errors.New("unexpected token in RPN")
 		}
+
+		if opts.trace != nil {
+			opts.trace(t, st)
+		}
 	}
 
 	if len(st) != 1 {
@@ -493,19 +1374,270 @@ func evalRPN(rpn []Token) (float64, error) {
 	return st[0], nil
 }
 
+// PercentOf returns pct percent of base.
+func PercentOf(base, pct float64) float64 {
+	return base * pct / 100
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func checkExponent(exp float64, opts Options) error {
+	if opts.MaxExponent > 0 && math.Abs(exp) > opts.MaxExponent {
+		return fmt.Errorf("exponent %v exceeds limit %v", exp, opts.MaxExponent)
+	}
+	return nil
+}
+
+func callFunc(ctx context.Context, fn Func, args []float64, timeout time.Duration) (float64, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	v, err := fn(ctx, args)
+	if err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+func isInt64(v float64) bool {
+	return v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64
+}
+
+func toInt64(op string, v float64) (int64, error) {
+	if !isInt64(v) {
+		return 0, fmt.Errorf("operator %q requires integer operands, got %v", op, v)
+	}
+	return int64(v), nil
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Tokenize splits expr into tokens. Each token's Pos is the byte offset
+// where it starts in expr; Line and Col give the same place 1-based.
+func Tokenize(expr string) ([]Token, error) {
+	return tokenize(expr, Options{})
+}
+
+// ToRPN converts expr to reverse-Polish order without evaluating it.
+// Function tokens carry the resolved argument count in Arity.
+func ToRPN(expr string) ([]Token, error) {
+	toks, err := tokenize(expr, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return toRPN(toks, Options{})
+}
+
+// insertImplicitMul returns tokens with a "*" inserted wherever a number,
+// percent literal or ")" is directly followed by an identifier, a named
+// constant or "(".
+func insertImplicitMul(tokens []Token) []Token {
+	var out []Token
+	for i, t := range tokens {
+		if i > 0 {
+			prev := tokens[i-1].Typ
+			named := t.Typ == TNumber && isIdentStart(t.Text[0])
+			if (prev == TNumber || prev == TPercent || prev == TRParen) && (t.Typ == TFunc || t.Typ == TLParen || named) {
+				if out == nil {
+					out = append(make([]Token, 0, len(tokens)+1), tokens[:i]...)
+				}
+				out = append(out, Token{Typ: TOp, Text: "*", Pos: t.Pos, Line: t.Line, Col: t.Col})
+			}
+		}
+		if out != nil {
+			out = append(out, t)
+		}
+	}
+	if out == nil {
+		return tokens
+	}
+	return out
+}
+
+// Validate reports whether expr is well formed without evaluating it.
+// Identifiers that are not constants are accepted as variables, so a
+// formula can be checked before its variables are bound.
+func Validate(expr string) error {
+	toks, err := tokenize(expr, Options{})
+	if err != nil {
+		return err
+	}
+	rpn, err := toRPN(toks, Options{Vars: map[string]float64{}})
+	if err != nil {
+		return err
+	}
+	return checkOperands(rpn)
+}
+
+// checkOperands walks rpn counting stack depth, catching missing or extra
+// operands without computing any values.
+func checkOperands(rpn []Token) error {
+	depth := 0
+	for _, t := range rpn {
+		need, push := 0, 1
+		switch t.Typ {
+		case TNumber, TPercent, TVar:
+		case TFunc:
+			need = t.Arity
+			if multiResultFuncs[t.Text] {
+				push = 2
+			}
+		case TOp:
+			switch t.Text {
+			case "NEG", "POS", "NOT":
+				need = 1
+			case "?:":
+				need = 3
+			case "?":
+				return errors.New("'?' without matching ':'")
+			default:
+				need = 2
+			}
+		default:
+			return errors.New("unexpected token in RPN")
+		}
+		if depth < need {
+			return errors.New("not enough operands")
+		}
+		depth += push - need
+	}
+	if depth != 1 {
+		return errors.New("expression error: extra values")
+	}
+	return nil
+}
+
 func EvalExpression(expr string) (float64, error) {
-	toks, err := tokenize(expr)
+	return EvalExpressionWithOptions(expr, Options{})
+}
+
+func EvalExpressionWithOptions(expr string, opts Options) (float64, error) {
+	return evalExpression(context.Background(), expr, opts)
+}
+
+// EvalExpressionContext is like EvalExpression but aborts with ctx.Err()
+// once ctx is done.
+func EvalExpressionContext(ctx context.Context, expr string) (float64, error) {
+	return evalExpression(ctx, expr, Options{})
+}
+
+// EvalExpressionContextWithOptions is like EvalExpressionWithOptions but
+// aborts with ctx.Err() once ctx is done. Functions in opts.Funcs receive a
+// context derived from ctx, so cancelling it also cancels a running call.
+func EvalExpressionContextWithOptions(ctx context.Context, expr string, opts Options) (float64, error) {
+	return evalExpression(ctx, expr, opts)
+}
+
+// EvalExpressionClampedInt evaluates expr, rounds the result to the
+// nearest integer and clamps it into [lo, hi].
+func EvalExpressionClampedInt(expr string, lo, hi int64) (int64, error) {
+	if lo > hi {
+		return 0, fmt.Errorf("invalid range [%d, %d]", lo, hi)
+	}
+	v, err := EvalExpression(expr)
 	if err != nil {
 		return 0, err
 	}
-	rpn, err := toRPN(toks)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("result %v is not a finite number", v)
+	}
+
+	r := math.Round(v)
+	if r <= float64(lo) {
+		return lo, nil
+	}
+	if r >= float64(hi) {
+		return hi, nil
+	}
+	return int64(r), nil
+}
+
+// tokenBufPool holds token slices reused across evaluations.
+var tokenBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]Token, 0, 32)
+		return &buf
+	},
+}
+
+// maxPooledTokens keeps unusually large buffers out of the pool.
+const maxPooledTokens = 1024
+
+func getTokenBuf() *[]Token {
+	return tokenBufPool.Get().(*[]Token)
+}
+
+func putTokenBuf(buf *[]Token) {
+	if cap(*buf) > maxPooledTokens {
+		return
+	}
+	*buf = (*buf)[:0]
+	tokenBufPool.Put(buf)
+}
+
+func evalExpression(ctx context.Context, expr string, opts Options) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	toks, stack, rpn := getTokenBuf(), getTokenBuf(), getTokenBuf()
+	defer putTokenBuf(toks)
+	defer putTokenBuf(stack)
+	defer putTokenBuf(rpn)
+
+	var err error
+	if *toks, err = tokenizeInto((*toks)[:0], expr, opts); err != nil {
+		return 0, err
+	}
+	if *rpn, err = toRPNInto((*rpn)[:0], (*stack)[:0], *toks, opts); err != nil {
+		return 0, err
+	}
+	v, err := evalRPN(ctx, *rpn, opts)
 	if err != nil {
 		return 0, err
 	}
-	return evalRPN(rpn)
+	if ((opts.ErrorOnNaN || opts.SafeMode) && math.IsNaN(v)) || ((opts.ErrorOnInf || opts.SafeMode) && math.IsInf(v, 0)) {
+		return 0, fmt.Errorf("result is not a finite number: %v", v)
+	}
+	if opts.SnapIntegerTolerance > 0 {
+		if r := math.Round(v); math.Abs(v-r) <= opts.SnapIntegerTolerance {
+			v = r
+		}
+	}
+	if opts.ResultTransform != nil {
+		v = opts.ResultTransform(v)
+	}
+	return v, nil
 }
 
+// constants maps the named constants to their values. It is only read
+// after initialization, which, along with the pooled token buffers, keeps
+// concurrent evaluations from sharing mutable state.
 var constants = map[string]float64{
-	"pi": math.Pi,
-	"e":  math.E,
+	"pi":  math.Pi,
+	"e":   math.E,
+	"tau": 2 * math.Pi,
+	"phi": math.Phi,
+	"inf": math.Inf(1),
+	"nan": math.NaN(),
+}
+
+// unsafeConstants are the constants SafeMode rejects.
+var unsafeConstants = map[string]bool{
+	"inf": true,
+	"nan": true,
 }
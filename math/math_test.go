@@ -1,8 +1,14 @@
 package math
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalExpression_AllOperators(t *testing.T) {
@@ -22,6 +28,9 @@ func TestEvalExpression_AllOperators(t *testing.T) {
 		{"-(3+4)*2", -14},
 		{"2^-3", 0.125},
 		{"1.5e2+2.5e-1", 150.25},
+		{"1_000+5", 1005},
+		{"1_000.50", 1000.5},
+		{"1.5e1_0", 1.5e10},
 	}
 
 	for _, tc := range cases {
@@ -57,6 +66,8 @@ func TestEvalExpression_Advanced(t *testing.T) {
 		{"(-2.5)^3 + 10%3", -15.325},
 		{"pow(2, 10) + atan2(1, 1)", math.Pow(2, 10) + math.Atan2(1, 1)},
 		{"logn(8, 2) + log(100)", math.Log(8)/math.Log(2) + math.Log10(100)},
+		{"copysign(3, -1)", -3},
+		{"copysign(-3, 2)", 3},
 	}
 
 	for _, tc := range cases {
@@ -69,3 +80,1603 @@ func TestEvalExpression_Advanced(t *testing.T) {
 		}
 	}
 }
+
+func TestEvalExpression_InvalidNumbers(t *testing.T) {
+	cases := []string{"1__0", "_1", "1_", "1_.5", "1e_5"}
+
+	for _, expr := range cases {
+		_, err := EvalExpression(expr)
+		if err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+		if !strings.Contains(err.Error(), "invalid number") {
+			t.Fatalf("unexpected error for %q: %v", expr, err)
+		}
+	}
+}
+
+func TestEvalExpression_Bitwise(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"12&10", 8},
+		{"12|3", 15},
+		{"12^^10", 6},
+		{"1<<4", 16},
+		{"256>>4", 16},
+		{"1<<2+1", 8},
+		{"255&15|16", 31},
+		{"2^3^^1", 9},
+		{"-8>>1", -4},
+		{"1<<62", 1 << 62},
+		{"-1<<63", -(1 << 63)},
+		{"0<<64", 0},
+		{"1>>64", 0},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"1.5&1", "1<<0.5", "1<<-1"} {
+		if _, err := EvalExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+
+	for _, expr := range []string{"1<<63", "1<<64", "3<<62", "-1<<64", "-2<<63"} {
+		_, err := EvalExpression(expr)
+		var oe *OverflowError
+		if !errors.As(err, &oe) || oe.Op != "<<" {
+			t.Fatalf("expected shift overflow for %q, got %v", expr, err)
+		}
+	}
+}
+
+func TestEvalExpression_Hyperbolic(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"sinh(1)", math.Sinh(1)},
+		{"cosh(1)", math.Cosh(1)},
+		{"tanh(0.5)", math.Tanh(0.5)},
+		{"asinh(2)", math.Asinh(2)},
+		{"acosh(2)", math.Acosh(2)},
+		{"atanh(0.5)", math.Atanh(0.5)},
+		{"cosh(2)^2-sinh(2)^2", 1},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	got, err := EvalExpression("acosh(0.5)")
+	if err != nil {
+		t.Fatalf("unexpected error for acosh(0.5): %v", err)
+	}
+	if !math.IsNaN(got) {
+		t.Fatalf("acosh(0.5) should be NaN, got %v", got)
+	}
+}
+
+func TestEvalExpression_PostfixPercent(t *testing.T) {
+	opts := Options{PostfixPercent: true}
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"50%", 0.5},
+		{"50 % 2", 1},
+		{"200*15%", 30},
+		{"(50%)+1", 1.5},
+		{"10% * 200", 20},
+		{"10%*200", 20},
+		{"10%2", 0.2},
+		{"10% (5)", 0.5},
+		{"10%-5", -4.9},
+		{"max(10%, 5%)", 0.1},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpressionWithOptions(tc.expr, opts)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	toks, err := tokenize("50%", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(toks) != 1 || toks[0].Typ != TPercent {
+		t.Fatalf("expected a single percent token, got %+v", toks)
+	}
+
+	if _, err := EvalExpression("50%"); err == nil {
+		t.Fatalf("expected error for trailing operator without the option")
+	}
+	if got, err := EvalExpression("10%2"); err != nil || got != 0.2 {
+		t.Fatalf("wrong result without the option: got %v, %v", got, err)
+	}
+}
+
+func TestEvalExpression_Vars(t *testing.T) {
+	opts := Options{Vars: map[string]float64{"x": 3, "rate": 0.5}}
+
+	got, err := EvalExpressionWithOptions("x^2 + rate*max(x, 4)", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 11 {
+		t.Fatalf("wrong result: got %v want 11", got)
+	}
+
+	if _, err := EvalExpressionWithOptions("y+1", opts); err == nil {
+		t.Fatalf("expected error for undefined variable")
+	}
+	if _, err := EvalExpression("x+1"); err == nil {
+		t.Fatalf("expected error for bare identifier without Vars")
+	}
+
+	mixed := Options{Vars: map[string]float64{"X": 1, "Rate": 2}}
+	got, err = EvalExpressionWithOptions("X+1 + rate*RATE", mixed)
+	if err != nil {
+		t.Fatalf("unexpected error for mixed-case variables: %v", err)
+	}
+	if got != 6 {
+		t.Fatalf("wrong result for mixed-case variables: got %v want 6", got)
+	}
+
+	for _, vars := range []map[string]float64{{"X": 1, "x": 2}, {"Ab": 1, "AB": 2, "c": 3}} {
+		_, err := EvalExpressionWithOptions("c", Options{Vars: vars})
+		if err == nil || !strings.Contains(err.Error(), "differ only by case") {
+			t.Fatalf("expected case collision error for %v, got %v", vars, err)
+		}
+	}
+}
+
+func TestToRPN(t *testing.T) {
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"2+3*4", "2 3 4 * +"},
+		{"2^3^2", "2 3 2 ^ ^"},
+		{"-(3+4)*2", "3 4 + NEG 2 *"},
+		{"2*-+-3", "2 3 NEG POS NEG *"},
+		{"-2^2", "2 2 ^ NEG"},
+		{"max(1, 2+3, 4)", "1 2 3 + 4 max/3"},
+		{"pow(2, 10) + pi", "2 10 pow/2 pi +"},
+	}
+
+	for _, tc := range cases {
+		rpn, err := ToRPN(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		var parts []string
+		for _, tok := range rpn {
+			if tok.Typ == TFunc {
+				parts = append(parts, fmt.Sprintf("%s/%d", tok.Text, tok.Arity))
+			} else {
+				parts = append(parts, tok.Text)
+			}
+		}
+		if got := strings.Join(parts, " "); got != tc.want {
+			t.Fatalf("wrong RPN for %q: got %q want %q", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	toks, err := Tokenize("sin(pi) + 12.5*x_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		typ  TokenType
+		text string
+		pos  int
+	}{
+		{TFunc, "sin", 0},
+		{TLParen, "(", 3},
+		{TNumber, "pi", 4},
+		{TRParen, ")", 6},
+		{TOp, "+", 8},
+		{TNumber, "12.5", 10},
+		{TOp, "*", 14},
+		{TFunc, "x_1", 15},
+	}
+	if len(toks) != len(want) {
+		t.Fatalf("wrong token count: got %d want %d", len(toks), len(want))
+	}
+	for i, w := range want {
+		if toks[i].Typ != w.typ || toks[i].Text != w.text || toks[i].Pos != w.pos {
+			t.Fatalf("wrong token %d: got %+v want %+v", i, toks[i], w)
+		}
+	}
+}
+
+func TestEvalExpression_EmptyParentheses(t *testing.T) {
+	for _, expr := range []string{"()", "2+()", "(())", "pi()"} {
+		_, err := EvalExpression(expr)
+		if err == nil || err.Error() != "empty parentheses" {
+			t.Fatalf("expected empty parentheses error for %q, got %v", expr, err)
+		}
+	}
+}
+
+func TestEvalExpression_MaxArgs(t *testing.T) {
+	args := strings.Repeat("1,", 20) + "1"
+
+	if _, err := EvalExpressionWithOptions("max("+args+")", Options{MaxArgs: 10}); err == nil {
+		t.Fatalf("expected error for too many arguments")
+	}
+	if _, err := EvalExpressionWithOptions("max(1,2,3)", Options{MaxArgs: 3}); err != nil {
+		t.Fatalf("unexpected error at the limit: %v", err)
+	}
+
+	huge := "min(" + strings.Repeat("1,", defaultMaxArgs) + "1)"
+	if _, err := EvalExpression(huge); err == nil {
+		t.Fatalf("expected default limit to reject %d arguments", defaultMaxArgs+1)
+	}
+}
+
+func TestEvalExpressionContext(t *testing.T) {
+	got, err := EvalExpressionContext(context.Background(), "2+3*4")
+	if err != nil || got != 14 {
+		t.Fatalf("unexpected result: got %v, %v", got, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := EvalExpressionContext(ctx, "2+3*4"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	rpn, err := ToRPN(strings.Repeat("1+", 1000) + "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := evalRPN(ctx, rpn, Options{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected evalRPN to stop on a canceled context, got %v", err)
+	}
+}
+
+func TestEvalExpression_MaxTokens(t *testing.T) {
+	opts := Options{MaxTokens: 1000}
+
+	huge := strings.Repeat("1+", 100000) + "1"
+	toks, err := tokenize(huge, opts)
+	if err == nil || err.Error() != "expression too large" {
+		t.Fatalf("expected expression too large, got %v", err)
+	}
+	if toks != nil {
+		t.Fatalf("expected no tokens on error")
+	}
+
+	if _, err := EvalExpressionWithOptions("1+2+3", Options{MaxTokens: 5}); err != nil {
+		t.Fatalf("unexpected error at the limit: %v", err)
+	}
+	if _, err := EvalExpressionWithOptions("1+2+3+4", Options{MaxTokens: 5}); err == nil {
+		t.Fatalf("expected error above the limit")
+	}
+}
+
+func TestEvalExpression_CostBudget(t *testing.T) {
+	opts := Options{
+		Costs:   map[string]int{"sqrt": 10},
+		MaxCost: 12,
+	}
+
+	if _, err := EvalExpressionWithOptions("sqrt(4)+1+1", opts); err != nil {
+		t.Fatalf("unexpected error within budget: %v", err)
+	}
+	if _, err := EvalExpressionWithOptions("sqrt(4)+sqrt(9)", opts); err == nil {
+		t.Fatalf("expected error above budget")
+	}
+	if _, err := EvalExpressionWithOptions("1+2+3+4", Options{MaxCost: 2}); err == nil {
+		t.Fatalf("expected uniform costs to exceed budget")
+	}
+}
+
+func TestEvalExpression_ResultTransform(t *testing.T) {
+	toDegrees := func(v float64) float64 { return v * 180 / math.Pi }
+
+	got, err := EvalExpressionWithOptions("atan(1)", Options{ResultTransform: toDegrees})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(got-45) > 1e-9 {
+		t.Fatalf("wrong result: got %v want 45", got)
+	}
+}
+
+func TestEvalExpression_VariadicArgumentOrder(t *testing.T) {
+	rpn, err := ToRPN("wavg(90, 2, 80+0, 1)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var texts []string
+	for _, tok := range rpn {
+		texts = append(texts, tok.Text)
+	}
+	if got := strings.Join(texts, " "); got != "90 2 80 0 + 1 wavg" {
+		t.Fatalf("arguments out of source order: %q", got)
+	}
+
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"wavg(90,2,80,1)", 260.0 / 3},
+		{"wavg(80,1,90,2)", 260.0 / 3},
+		{"wavg(max(1,90),2,80,min(1,5))", 260.0 / 3},
+		{"wavg(10,0,20,1)", 20},
+	}
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"wavg(1)", "wavg(1,2,3)", "wavg(1,0)"} {
+		if _, err := EvalExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalExpression_Multiline(t *testing.T) {
+	got, err := EvalExpression("2 +\n  3 *\n  4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 14 {
+		t.Fatalf("wrong result: got %v want 14", got)
+	}
+
+	_, err = EvalExpression("1 +\n  2 $ 3")
+	if err == nil {
+		t.Fatalf("expected error for unexpected character")
+	}
+	if want := `unexpected character: "$" at line 2, column 5`; err.Error() != want {
+		t.Fatalf("wrong error: got %q want %q", err.Error(), want)
+	}
+
+	toks, err := Tokenize("1 +\n\tx")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	last := toks[len(toks)-1]
+	if last.Line != 2 || last.Col != 2 {
+		t.Fatalf("wrong position for %q: line %d, column %d", last.Text, last.Line, last.Col)
+	}
+}
+
+func TestEvalExpressionClampedInt(t *testing.T) {
+	cases := []struct {
+		expr   string
+		lo, hi int64
+		want   int64
+	}{
+		{"7/2", 0, 10, 4},
+		{"-7/2", -10, 10, -4},
+		{"2^10", 0, 100, 100},
+		{"-50", 0, 100, 0},
+		{"1e300", math.MinInt64, math.MaxInt64, math.MaxInt64},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpressionClampedInt(tc.expr, tc.lo, tc.hi)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %d want %d", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"sqrt(-1)", "1/0"} {
+		if _, err := EvalExpressionClampedInt(expr, 0, 10); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+	if _, err := EvalExpressionClampedInt("1", 5, 1); err == nil {
+		t.Fatalf("expected error for an empty range")
+	}
+}
+
+func TestEvalExpression_ComparisonAndTernary(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"3>2", 1},
+		{"3<2", 0},
+		{"2>=2", 1},
+		{"2<=1", 0},
+		{"1+1==2", 1},
+		{"1!=1", 0},
+		{"1<2==1", 1},
+		{"1>0?5:6", 5},
+		{"0?5:6", 6},
+		{"1?0?1:2:3", 2},
+		{"0?1:0?2:3", 3},
+		{"0?1:1?2:3", 2},
+		{"(1>0?2:3)*10", 20},
+		{"1>0?-5:-6", -5},
+		{"max(1<2?7:8, 3)", 7},
+		{"2+3>4?10:20", 10},
+		{"1<<2>3", 1},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	qty := func(q float64) Options { return Options{Vars: map[string]float64{"qty": q, "price": 100}} }
+	for q, want := range map[float64]float64{5: 100, 20: 90} {
+		got, err := EvalExpressionWithOptions("qty > 10 ? price*0.9 : price", qty(q))
+		if err != nil {
+			t.Fatalf("unexpected error for qty %v: %v", q, err)
+		}
+		if math.Abs(got-want) > 1e-9 {
+			t.Fatalf("wrong price for qty %v: got %v want %v", q, got, want)
+		}
+	}
+
+	for _, expr := range []string{"1?2", "1:2", "(1?2):3", "max(1?2, 3)"} {
+		if _, err := EvalExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalExpression_NaNReplacement(t *testing.T) {
+	zero := 0.0
+	opts := Options{NaNReplacement: &zero}
+
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"ln(-1)", 0},
+		{"ln(-1)+5", 5},
+		{"sqrt(-4)*2+1", 1},
+		{"0/0", 0},
+	}
+	for _, tc := range cases {
+		got, err := EvalExpressionWithOptions(tc.expr, opts)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	got, err := EvalExpression("ln(-1)+5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !math.IsNaN(got) {
+		t.Fatalf("expected NaN without replacement, got %v", got)
+	}
+}
+
+func TestEvalExpression_Logical(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"1>0 && 2>3", 0},
+		{"1>0 && 3>2", 1},
+		{"0 || 2>3", 0},
+		{"0 || -2", 1},
+		{"!(0)", 1},
+		{"!5", 0},
+		{"!!5", 1},
+		{"!0 && 0 || 1", 1},
+		{"1 || 0 && 0", 1},
+		{"!(1>2) ? 7 : 8", 7},
+		{"1 != 2 && 3 == 3", 1},
+		{"3&1 && 2|0", 1},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"5!", "1 &&", "(2)!3"} {
+		if _, err := EvalExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalExpression_IntFracPart(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"intpart(3.75)", 3},
+		{"fracpart(3.75)", 0.75},
+		{"intpart(-3.75)", -3},
+		{"fracpart(-3.75)", -0.75},
+		{"intpart(2.5)+fracpart(2.5)", 2.5},
+		{"trunc(3.7)", 3},
+		{"frac(3.7)", 0.7},
+		{"trunc(-3.7)", -3},
+		{"floor(-3.7)", -4},
+		{"frac(-3.7)", -0.7},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestEvalExpression_TrailingOperator(t *testing.T) {
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"2+", `expression ends with an operator "+" at line 1, column 2`},
+		{"3*", `expression ends with an operator "*" at line 1, column 2`},
+		{"5*", `expression ends with an operator "*" at line 1, column 2`},
+		{"2^", `expression ends with an operator "^" at line 1, column 2`},
+		{"1 +\n 2 -", `expression ends with an operator "-" at line 2, column 4`},
+		{"(1+2)*-", `expression ends with an operator "-" at line 1, column 7`},
+		{"-", `expression ends with an operator "-" at line 1, column 1`},
+		{"*", `expression ends with an operator "*" at line 1, column 1`},
+	}
+
+	for _, tc := range cases {
+		_, err := EvalExpression(tc.expr)
+		if err == nil || err.Error() != tc.want {
+			t.Fatalf("wrong error for %q: got %v want %q", tc.expr, err, tc.want)
+		}
+		if !errors.Is(err, ErrTrailingOperator) {
+			t.Fatalf("error for %q should wrap ErrTrailingOperator: %v", tc.expr, err)
+		}
+	}
+
+	if _, err := EvalExpression("2+3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestEvalExpression_ErrorOnNonFinite(t *testing.T) {
+	opts := Options{ErrorOnNaN: true, ErrorOnInf: true}
+
+	for _, expr := range []string{"sqrt(-1)", "1/0", "asin(2)", "-1/0", "0/0"} {
+		if _, err := EvalExpression(expr); err != nil {
+			t.Fatalf("unexpected error without options for %q: %v", expr, err)
+		}
+		_, err := EvalExpressionWithOptions(expr, opts)
+		if err == nil || !strings.Contains(err.Error(), "result is not a finite number") {
+			t.Fatalf("expected non-finite error for %q, got %v", expr, err)
+		}
+	}
+
+	if _, err := EvalExpressionWithOptions("1/0", Options{ErrorOnNaN: true}); err != nil {
+		t.Fatalf("ErrorOnNaN alone should allow Inf: %v", err)
+	}
+	if _, err := EvalExpressionWithOptions("sqrt(-1)", Options{ErrorOnInf: true}); err != nil {
+		t.Fatalf("ErrorOnInf alone should allow NaN: %v", err)
+	}
+	if _, err := EvalExpressionWithOptions("2+2", opts); err != nil {
+		t.Fatalf("unexpected error for a finite result: %v", err)
+	}
+}
+
+func TestEvalExpression_PercentOfSum(t *testing.T) {
+	opts := Options{PercentOfSum: true}
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"200+10%", 220},
+		{"200-10%", 180},
+		{"200*10%", 20},
+		{"(50+50)+5%", 105},
+		{"200+10%+10%", 242},
+		{"10%", 0.1},
+		{"200 % 10", 20},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpressionWithOptions(tc.expr, opts)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	if got := PercentOf(200, 10); got != 20 {
+		t.Fatalf("PercentOf(200, 10) = %v, want 20", got)
+	}
+}
+
+func TestEvalExpression_ResolveCall(t *testing.T) {
+	opts := Options{
+		ResolveCall: func(name string, args []float64) (float64, bool, error) {
+			if name != "double" {
+				return 0, false, nil
+			}
+			if len(args) != 1 {
+				return 0, true, fmt.Errorf("double expects 1 argument")
+			}
+			return 2 * args[0], true, nil
+		},
+	}
+
+	got, err := EvalExpressionWithOptions("double(3) + max(1, double(2))", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 10 {
+		t.Fatalf("wrong result: got %v want 10", got)
+	}
+
+	if _, err := EvalExpressionWithOptions("triple(3)", opts); err == nil || !strings.Contains(err.Error(), "unknown function") {
+		t.Fatalf("expected unknown function error, got %v", err)
+	}
+	if _, err := EvalExpressionWithOptions("double(1, 2)", opts); err == nil {
+		t.Fatalf("expected resolver error to propagate")
+	}
+}
+
+func TestEvalExpression_GcdLcm(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"gcd(12,18)", 6},
+		{"lcm(4,6)", 12},
+		{"gcd(-12,18)", 6},
+		{"lcm(-4,6)", 12},
+		{"gcd(0,5)", 5},
+		{"lcm(0,5)", 0},
+		{"gcd(0,0)", 0},
+		{"gcd(2^40, 2^20*3)", 1 << 20},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"gcd(2.5,4)", "lcm(4,0.5)", "gcd(1)", "lcm(2^52-1, 2^52-3)"} {
+		if _, err := EvalExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalExpression_SumAvg(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"sum(1,2,3)", 6},
+		{"sum(1,2,3,4)", 10},
+		{"sum(5)", 5},
+		{"avg(2,4,6)", 4},
+		{"avg(1,2)", 1.5},
+		{"sum(1, max(2,3), 4)", 8},
+		{"avg(sum(1,1), 4)*2", 6},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"sum()", "avg()"} {
+		if _, err := EvalExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalExpression_FuncTimeout(t *testing.T) {
+	opts := Options{
+		Funcs: map[string]Func{
+			"double": func(ctx context.Context, args []float64) (float64, error) {
+				return 2 * args[0], nil
+			},
+			"slow": func(ctx context.Context, args []float64) (float64, error) {
+				select {
+				case <-ctx.Done():
+					return 0, ctx.Err()
+				case <-time.After(time.Second):
+					return args[0], nil
+				}
+			},
+		},
+		FuncTimeout: 10 * time.Millisecond,
+	}
+
+	got, err := EvalExpressionWithOptions("double(3) + 1", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 7 {
+		t.Fatalf("wrong result: got %v want 7", got)
+	}
+
+	start := time.Now()
+	_, err = EvalExpressionWithOptions("1 + slow(2)", opts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("slow function was not cancelled, took %v", elapsed)
+	}
+
+	opts.FuncTimeout = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start = time.Now()
+	_, err = EvalExpressionContextWithOptions(ctx, "1 + slow(2)", opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation from the parent context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("slow function was not cancelled with its parent, took %v", elapsed)
+	}
+}
+
+func TestEvalExpression_Clamp(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"clamp(5,0,1)", 1},
+		{"clamp(-2,0,1)", 0},
+		{"clamp(0.5,0,1)", 0.5},
+		{"clamp(3,3,3)", 3},
+		{"clamp(2*5, -1, max(4, 6))", 6},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"clamp(0.5,1,0)", "clamp(1,2)", "clamp(1,2,3,4)"} {
+		if _, err := EvalExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalExpression_MinusAfterParen(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"(2)-3", -1},
+		{"(2)*-3", -6},
+		{"(2)--3", 5},
+		{"(2)-(3)", -1},
+		{"max(1,2)-3", -1},
+		{"(2)- -3", 5},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestEvalExpression_Roots(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"cbrt(-27)", -3},
+		{"cbrt(8)", 2},
+		{"root(16,4)", 2},
+		{"root(-8,3)", -2},
+		{"root(9,2)", 3},
+		{"root(-32,5)", -2},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if math.Abs(got-tc.want) > 1e-12 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		expr string
+		want float64
+	}{
+		{"root(-8,3)", -2},
+		{"root(27,3)", 3},
+		{"root(-27,3)", -3},
+		{"root(1000,3)", 10},
+	} {
+		got, err := EvalExpression(tc.expr)
+		if err != nil || got != tc.want {
+			t.Fatalf("cube root %q should be exact: got %v, %v want %v", tc.expr, got, err, tc.want)
+		}
+	}
+
+	got, err := EvalExpression("root(-16,4)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !math.IsNaN(got) {
+		t.Fatalf("even root of a negative number should be NaN, got %v", got)
+	}
+	if _, err := EvalExpression("root(8)"); err == nil {
+		t.Fatalf("expected arity error")
+	}
+}
+
+func TestEvalExpression_PercentagePoints(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"5% + 3%", 0.08},
+		{"5% - 3%", 0.02},
+		{"3% - 5%", -0.02},
+		{"100 * (5% - 3%)", 2},
+	}
+
+	for _, opts := range []Options{{PostfixPercent: true}, {PercentOfSum: true}} {
+		for _, tc := range cases {
+			got, err := EvalExpressionWithOptions(tc.expr, opts)
+			if err != nil {
+				t.Fatalf("unexpected error for %q with %+v: %v", tc.expr, opts, err)
+			}
+			if math.Abs(got-tc.want) > 1e-12 {
+				t.Fatalf("wrong result for %q with %+v: got %v want %v", tc.expr, opts, got, tc.want)
+			}
+		}
+	}
+
+	got, err := EvalExpressionWithOptions("200 + 5% - 3%", Options{PercentOfSum: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(got-203.7) > 1e-9 {
+		t.Fatalf("percent-of-sum should still chain on an amount: got %v want 203.7", got)
+	}
+}
+
+func TestEvalExpression_Hypot(t *testing.T) {
+	got, err := EvalExpression("hypot(3,4)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 5 {
+		t.Fatalf("wrong result: got %v want 5", got)
+	}
+
+	naive, err := EvalExpression("sqrt(1e200^2+1e200^2)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !math.IsInf(naive, 1) {
+		t.Fatalf("expected the naive formula to overflow, got %v", naive)
+	}
+	got, err = EvalExpression("hypot(1e200,1e200)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := 1e200 * math.Sqrt2; math.IsInf(got, 0) || math.Abs(got-want)/want > 1e-15 {
+		t.Fatalf("wrong result: got %v want %v", got, want)
+	}
+
+	if _, err := EvalExpression("hypot(3)"); err == nil {
+		t.Fatalf("expected arity error")
+	}
+}
+
+func TestEvalExpression_DegRad(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"deg(pi)", 180},
+		{"rad(180)", math.Pi},
+		{"sin(rad(90))", 1},
+		{"deg(rad(37))", 37},
+		{"deg(-pi/2)", -90},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestEvalExpression_SnapIntegerTolerance(t *testing.T) {
+	opts := Options{SnapIntegerTolerance: 1e-9}
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"(0.1+0.7)*10", 8},
+		{"0.1*3*10", 3},
+		{"-(0.1+0.7)*10", -8},
+		{"2.5", 2.5},
+		{"5+1e-6", 5 + 1e-6},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpressionWithOptions(tc.expr, opts)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	below, _ := EvalExpression("(0.1+0.7)*10")
+	above, _ := EvalExpression("0.1*3*10")
+	if below >= 8 || above <= 3 {
+		t.Fatalf("test inputs no longer straddle integers: %v, %v", below, above)
+	}
+}
+
+func TestEvalExpression_MultiResult(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"minmax(1,5,3) -", 4},
+		{"minmax(1,5,3) +", 6},
+		{"minmax(2,8) /", 4},
+		{"minmax(7) -", 0},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"minmax(1,5,3)", "minmax(1,5) - 1", "max(1,5) -", "(minmax(1,5)) -", "minmax(1,5) ?"} {
+		if _, err := EvalExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalExpression_OctalLeadingZero(t *testing.T) {
+	opts := Options{OctalLeadingZero: true}
+	cases := []struct {
+		expr       string
+		octal, dec float64
+	}{
+		{"017", 15, 17},
+		{"007", 7, 7},
+		{"010+1", 9, 11},
+		{"0.5", 0.5, 0.5},
+		{"0", 0, 0},
+		{"0 + 10", 10, 10},
+		{"0_17", 15, 17},
+		{"01_0", 8, 10},
+		{"00.5", 0.5, 0.5},
+		{"017.5", 17.5, 17.5},
+		{"017e2", 1700, 1700},
+		{"00", 0, 0},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpressionWithOptions(tc.expr, opts)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.octal {
+			t.Fatalf("wrong octal result for %q: got %v want %v", tc.expr, got, tc.octal)
+		}
+		got, err = EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.dec {
+			t.Fatalf("wrong decimal result for %q: got %v want %v", tc.expr, got, tc.dec)
+		}
+	}
+
+	got, err := EvalExpressionWithOptions("0o17 + 0O1_0", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 23 {
+		t.Fatalf("wrong result for 0o prefix: got %v want 23", got)
+	}
+
+	for _, expr := range []string{"018", "0o17.5", "0o8", "0_", "0__17", "0_8"} {
+		if _, err := EvalExpressionWithOptions(expr, opts); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+	if _, err := EvalExpression("0o17"); err == nil {
+		t.Fatalf("expected 0o prefix to be rejected without the option")
+	}
+}
+
+func TestEvalExpression_MaxExponent(t *testing.T) {
+	opts := Options{MaxExponent: 1000}
+
+	for expr, want := range map[string]float64{"2^10": 1024, "pow(2, -2)": 0.25, "10^1000 > 0": 1} {
+		got, err := EvalExpressionWithOptions(expr, opts)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", expr, err)
+		}
+		if got != want {
+			t.Fatalf("wrong result for %q: got %v want %v", expr, got, want)
+		}
+	}
+
+	for _, expr := range []string{"2^1e9", "pow(2, 1001)", "2^-1e9", "1 + 2^(10^4)"} {
+		if _, err := EvalExpressionWithOptions(expr, opts); err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+			t.Fatalf("expected exponent limit error for %q, got %v", expr, err)
+		}
+	}
+
+	if _, err := EvalExpression("2^1e9"); err != nil {
+		t.Fatalf("exponent should be unlimited by default: %v", err)
+	}
+}
+
+func TestEvalExpression_MaxDepth(t *testing.T) {
+	opts := Options{MaxDepth: 100}
+
+	got, err := EvalExpressionWithOptions("((1+2))*max(1, (3))", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 9 {
+		t.Fatalf("wrong result: got %v want 9", got)
+	}
+
+	const n = 100000
+	deep := strings.Repeat("(", n) + "1" + strings.Repeat(")", n)
+	if _, err := EvalExpressionWithOptions(deep, opts); err == nil || err.Error() != "expression too deeply nested" {
+		t.Fatalf("expected nesting error, got %v", err)
+	}
+
+	calls := strings.Repeat("abs(", 101) + "1" + strings.Repeat(")", 101)
+	if _, err := EvalExpressionWithOptions(calls, opts); err == nil {
+		t.Fatalf("expected nesting error for nested calls")
+	}
+	if _, err := EvalExpressionWithOptions(strings.Repeat("abs(", 100)+"1"+strings.Repeat(")", 100), opts); err != nil {
+		t.Fatalf("unexpected error at the depth limit: %v", err)
+	}
+}
+
+func TestEvalExpression_Rmse(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"rmse(2, 1, 4, 5)", 1},
+		{"rmse(3, 3)", 0},
+		{"rmse(1, 4)", 3},
+		{"rmse(0, 1, 0, 1, 0, 1, 0, 1)", 1},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if math.Abs(got-tc.want) > 1e-12 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"rmse(1)", "rmse(1, 2, 3)"} {
+		if _, err := EvalExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalExpression_ParenPositions(t *testing.T) {
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"(2+3", "unclosed '(' at line 1, column 1"},
+		{"2+3)", "unmatched ')' at line 1, column 4"},
+		{"((2+3)", "unclosed '(' at line 1, column 1"},
+		{"max(1, (2)", "unclosed '(' at line 1, column 4"},
+		{"(1+2))*3", "unmatched ')' at line 1, column 6"},
+		{"(1+\n(2)", "unclosed '(' at line 1, column 1"},
+		{"1+\n2)", "unmatched ')' at line 2, column 2"},
+	}
+
+	for _, tc := range cases {
+		_, err := EvalExpression(tc.expr)
+		if err == nil || err.Error() != tc.want {
+			t.Fatalf("wrong error for %q: got %v want %q", tc.expr, err, tc.want)
+		}
+	}
+}
+
+func TestEvalExpression_SafeMode(t *testing.T) {
+	got, err := EvalExpression("inf+1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !math.IsInf(got, 1) {
+		t.Fatalf("wrong result: got %v want +Inf", got)
+	}
+	got, err = EvalExpression("nan")
+	if err != nil || !math.IsNaN(got) {
+		t.Fatalf("wrong result for nan: got %v, %v", got, err)
+	}
+
+	safe := Options{SafeMode: true}
+	for _, expr := range []string{"inf+1", "-INF", "max(1, nan)", "1/0", "0/0", "sqrt(-1)"} {
+		if _, err := EvalExpressionWithOptions(expr, safe); err == nil {
+			t.Fatalf("expected error for %q in safe mode", expr)
+		}
+	}
+	if _, err := EvalExpressionWithOptions("inf+1", safe); err == nil || !strings.Contains(err.Error(), "safe mode") {
+		t.Fatalf("expected safe mode error, got %v", err)
+	}
+
+	got, err = EvalExpressionWithOptions("2*pi", safe)
+	if err != nil {
+		t.Fatalf("unexpected error in safe mode: %v", err)
+	}
+	if got != 2*math.Pi {
+		t.Fatalf("wrong result: got %v want %v", got, 2*math.Pi)
+	}
+}
+
+func TestEvalExpression_TauPhi(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"tau/2", math.Pi},
+		{"phi^2 - phi", 1},
+		{"1/phi + 1", math.Phi},
+		{"cos(tau)", 1},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestEvalExpressionWithOptions_PowerLeftAssoc(t *testing.T) {
+	left := Options{PowerLeftAssoc: true}
+	cases := []struct {
+		expr        string
+		right, left float64
+	}{
+		{"2^3^2", 512, 64},
+		{"2^3^2^0", 8, 1},
+		{"2*3^2^2", 162, 162},
+		{"(2^3)^2", 64, 64},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil || got != tc.right {
+			t.Fatalf("wrong default result for %q: got %v, %v want %v", tc.expr, got, err, tc.right)
+		}
+		got, err = EvalExpressionWithOptions(tc.expr, left)
+		if err != nil || got != tc.left {
+			t.Fatalf("wrong left-associative result for %q: got %v, %v want %v", tc.expr, got, err, tc.left)
+		}
+	}
+}
+
+func TestEvalExpression_StackedUnary(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"--5", 5},
+		{"+-3", -3},
+		{"-+3", -3},
+		{"2*--3", 6},
+		{"---5", -5},
+		{"-+-5", 5},
+		{"2*---3", -6},
+		{"1 - --2", -1},
+		{"-2^2", -4},
+		{"--2^2", 4},
+		{"---2^2", -4},
+		{"2^--2", 4},
+		{"(-2)^2", 4},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestEvalExpression_UnaryMinusPower(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"-2^2", -4},
+		{"-2^3", -8},
+		{"(-2)^2", 4},
+		{"(-2)^3", -8},
+		{"2^-1", 0.5},
+		{"-2^-1", -0.5},
+		{"-2^2*3", -12},
+		{"3*-2^2", -12},
+		{"-2^2+5", 1},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	above := Options{Unary: UnaryAbovePower}
+	if got, err := EvalExpressionWithOptions("-2^2", above); err != nil || got != 4 {
+		t.Fatalf("wrong result with UnaryAbovePower: got %v, %v want 4", got, err)
+	}
+}
+
+func TestEvalExpression_FloorDivision(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"7//2", 3},
+		{"-7//2", -4},
+		{"7//-2", -4},
+		{"7.5 // 2", 3},
+		{"2*7//2", 7},
+		{"7//2*2", 6},
+		{"1 + 9//2", 5},
+		{"8//2//2", 2},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	toks, err := Tokenize("7//2")
+	if err != nil || len(toks) != 3 || toks[1].Text != "//" {
+		t.Fatalf("expected a single // token, got %v, %v", toks, err)
+	}
+	if _, err := EvalExpression("1//0"); err == nil || !strings.Contains(err.Error(), "division by zero") {
+		t.Fatalf("expected division by zero, got %v", err)
+	}
+	if _, err := EvalExpression("7/ /2"); err == nil {
+		t.Fatalf("expected error for separated slashes")
+	}
+}
+
+func TestEvalExpression_Fmod(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"fmod(7, 3)", 1},
+		{"fmod(-7, 3)", 2},
+		{"fmod(7, -3)", -2},
+		{"fmod(-7, -3)", -1},
+		{"fmod(5.5, 2)", 1.5},
+		{"fmod(6, 3)", 0},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, ab := range [][2]float64{{-7, 3}, {7, -3}, {7.5, 2}, {-7.5, -2}} {
+		expr := fmt.Sprintf("(%v)//(%v)*(%v) + fmod(%v, %v)", ab[0], ab[1], ab[1], ab[0], ab[1])
+		got, err := EvalExpression(expr)
+		if err != nil || got != ab[0] {
+			t.Fatalf("identity a == (a//b)*b + fmod(a, b) fails for %v: got %v, %v", ab, got, err)
+		}
+	}
+
+	if _, err := EvalExpression("fmod(1, 0)"); err == nil {
+		t.Fatalf("expected division by zero")
+	}
+}
+
+func TestToken_JSON(t *testing.T) {
+	toks, err := ToRPN("max(2, 3) + 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := json.Marshal(toks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"Typ":"func","Text":"max","Value":0,"Arity":2`) {
+		t.Fatalf("function token not encoded by name: %s", data)
+	}
+	if !strings.Contains(string(data), `"Typ":"number","Text":"2","Value":2`) {
+		t.Fatalf("number token not encoded by name: %s", data)
+	}
+
+	var back []Token
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(back) != len(toks) {
+		t.Fatalf("wrong token count: got %d want %d", len(back), len(toks))
+	}
+	for i := range toks {
+		if back[i] != toks[i] {
+			t.Fatalf("token %d did not round-trip: got %+v want %+v", i, back[i], toks[i])
+		}
+	}
+
+	for typ := TNumber; typ <= TVar; typ++ {
+		text, err := typ.MarshalText()
+		if err != nil {
+			t.Fatalf("unexpected error for %d: %v", typ, err)
+		}
+		var got TokenType
+		if err := got.UnmarshalText(text); err != nil || got != typ {
+			t.Fatalf("type %d did not round-trip through %q: got %d, %v", typ, text, got, err)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"Typ":"bogus"}`), new(Token)); err == nil {
+		t.Fatalf("expected error for unknown token type")
+	}
+	if _, err := json.Marshal(Token{Typ: TokenType(99)}); err == nil {
+		t.Fatalf("expected error for out-of-range token type")
+	}
+}
+
+func TestTokenType_String(t *testing.T) {
+	cases := []struct {
+		typ  TokenType
+		want string
+	}{
+		{TNumber, "Number"},
+		{TOp, "Op"},
+		{TFunc, "Func"},
+		{TComma, "Comma"},
+		{TLParen, "LParen"},
+		{TRParen, "RParen"},
+		{TPercent, "Percent"},
+		{TVar, "Var"},
+		{TokenType(99), "TokenType(99)"},
+	}
+
+	for _, tc := range cases {
+		if got := tc.typ.String(); got != tc.want {
+			t.Fatalf("TokenType(%d).String() = %q, want %q", int(tc.typ), got, tc.want)
+		}
+	}
+
+	toks, err := ToRPN("max(2, 3) + 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := fmt.Sprint(toks); got != "[Number(2) Number(3) Func(max/2) Number(1) Op(+)]" {
+		t.Fatalf("wrong token strings: %s", got)
+	}
+}
+
+func TestEvalExpression_UnaryPlus(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"+3.5", 3.5},
+		{"++3.5", 3.5},
+		{"+-3.5", -3.5},
+		{"2*+3", 6},
+		{"+(1/3)", 1.0 / 3},
+		{"+1e308*10", math.Inf(1)},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"+-0", "+(-0)", "-+0"} {
+		got, err := EvalExpression(expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", expr, err)
+		}
+		if got != 0 || !math.Signbit(got) {
+			t.Fatalf("unary plus should keep negative zero for %q, got %v", expr, got)
+		}
+	}
+	got, err := EvalExpression("+0")
+	if err != nil || math.Signbit(got) {
+		t.Fatalf("+0 should stay positive zero, got %v, %v", got, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, expr := range []string{"2+3", "x*2 + max(y, 1)", "a > 0 ? a : -a", "minmax(1, 2) -", "sin(pi)"} {
+		if err := Validate(expr); err != nil {
+			t.Fatalf("unexpected error for %q: %v", expr, err)
+		}
+	}
+
+	for _, expr := range []string{"2+", "(2+3", "2+3)", "2 3", "max(1,)", "", "1 ? 2", "2 $ 3"} {
+		if err := Validate(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalExpression_ImplicitMultiplication(t *testing.T) {
+	opts := Options{ImplicitMultiplication: true, Vars: map[string]float64{"x": 3}}
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"2x", 6},
+		{"2(3+1)", 8},
+		{"(1+1)(2+2)", 8},
+		{"2max(1, x)", 6},
+		{"1/2x", 1.5},
+		{"2pi", 2 * math.Pi},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpressionWithOptions(tc.expr, opts)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	if _, err := EvalExpression("2(3)"); err == nil {
+		t.Fatalf("implicit multiplication should be off by default")
+	}
+}
+
+func TestEvalExpression_EmptyArgument(t *testing.T) {
+	for _, expr := range []string{"max(,2)", "max(2,)", "max(2,,3)", "pow(2,)", "sin(,)", "max((1),)"} {
+		if _, err := EvalExpression(expr); err == nil || err.Error() != "empty function argument" {
+			t.Fatalf("expected empty argument error for %q, got %v", expr, err)
+		}
+	}
+
+	got, err := EvalExpression("max(2,3)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 3 {
+		t.Fatalf("wrong result: got %v want 3", got)
+	}
+}
+
+func BenchmarkEvalExpression(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := EvalExpression("12.5*(3-1)/4 + max(2, 3^2) - sin(pi/2)"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,590 @@
+package math
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	moneyDecimals    = 2
+	maxMoneyDecimals = 16
+
+	// maxMoneyExponent bounds "^" in money expressions, which multiplies
+	// once per unit of the exponent.
+	maxMoneyExponent = 10000
+)
+
+// RoundingMode selects how money division, multiplication and percent
+// results are rounded to the evaluation scale.
+type RoundingMode int
+
+// The examples round a result of -2.5 and 2.5 cents to whole cents.
+const (
+	// HalfAwayFromZero rounds ties away from zero: -2.5 is -3, 2.5 is 3.
+	// It is the default.
+	HalfAwayFromZero RoundingMode = iota
+	// HalfEven rounds ties to the even neighbor, as banks do: -2.5 is -2,
+	// 2.5 is 2 and -3.5 is -4.
+	HalfEven
+	// HalfUp rounds ties toward positive infinity: -2.5 is -2, 2.5 is 3.
+	// Unlike Java's HALF_UP it does not round negative ties away from zero;
+	// use HalfAwayFromZero for that.
+	HalfUp
+	// Floor rounds toward negative infinity: -2.5 is -3, 2.5 is 2.
+	Floor
+	// Ceil rounds toward positive infinity: -2.5 is -2, 2.5 is 3.
+	Ceil
+	// Truncate rounds toward zero: -2.5 is -2, 2.5 is 2.
+	Truncate
+)
+
+// MoneyOptions tunes EvalMoneyExpressionWithOptions. The zero value matches
+// EvalMoneyExpression.
+type MoneyOptions struct {
+	Rounding RoundingMode
+
+	// StripSymbols lists currency symbols to ignore when they sit directly
+	// before a number, as in "$19.99". Anywhere else, including right after
+	// a number as in "10$5", they are errors.
+	StripSymbols []rune
+
+	// PromoteOverflow redoes a multiplication that overflows int64 in
+	// big.Int, so an intermediate product such as a*b in a*b/scale only
+	// fails when the rounded result itself does not fit. Division always
+	// does this, since its scaled dividend a*scale overflows for ordinary
+	// amounts at high scales.
+	PromoteOverflow bool
+
+	// AllowExponent accepts literals in scientific notation such as 1.5e2.
+	// The exponent is applied to the decimal digits exactly, so 1.2345e2
+	// is still rejected for having too many decimal places.
+	AllowExponent bool
+}
+
+// EvalMoneyExpression evaluates expr in exact fixed-point arithmetic and
+// returns the result in cents.
+func EvalMoneyExpression(expr string) (int64, error) {
+	return EvalMoneyExpressionScale(expr, moneyDecimals)
+}
+
+// EvalMoneyExpressionScale is like EvalMoneyExpression but works in units
+// of 10^-decimals, e.g. 3 for currencies with mills or 6 for micro-units
+// when sub-cent precision matters.
+func EvalMoneyExpressionScale(expr string, decimals int) (int64, error) {
+	cents, _, err := evalMoney(expr, decimals, MoneyOptions{})
+	return cents, err
+}
+
+// EvalMoneyExpressionWithOptions is like EvalMoneyExpression with the
+// behavior adjusted by opts.
+func EvalMoneyExpressionWithOptions(expr string, opts MoneyOptions) (int64, error) {
+	cents, _, err := evalMoney(expr, moneyDecimals, opts)
+	return cents, err
+}
+
+// EvalMoneyAudit is like EvalMoneyExpression but also reports whether any
+// division, multiplication or percent had to round away a remainder.
+func EvalMoneyAudit(expr string) (cents int64, rounded bool, err error) {
+	return evalMoney(expr, moneyDecimals, MoneyOptions{})
+}
+
+// EvalMoneyExpressionGrouped is like EvalMoneyExpression but reads commas
+// between digits as thousands separators, so "1,200.50" is 1200.50. Groups
+// after the first must have exactly three digits.
+func EvalMoneyExpressionGrouped(expr string) (int64, error) {
+	ungrouped, err := ungroupNumbers(expr)
+	if err != nil {
+		return 0, err
+	}
+	return EvalMoneyExpression(ungrouped)
+}
+
+func ungroupNumbers(s string) (string, error) {
+	var b strings.Builder
+	i := 0
+	for i < len(s) {
+		if !isDigit(s[i]) || (i > 0 && (isIdentContinue(s[i-1]) || s[i-1] == '.')) {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+		b.WriteString(s[start:i])
+		if i+1 >= len(s) || s[i] != ',' || !isDigit(s[i+1]) {
+			continue
+		}
+		if i-start > 3 {
+			return "", errorAt(s, start, "invalid digit grouping near %q", s[start:i+1])
+		}
+		for i+1 < len(s) && s[i] == ',' && isDigit(s[i+1]) {
+			group := i + 1
+			i = group
+			for i < len(s) && isDigit(s[i]) {
+				i++
+			}
+			if i-group != 3 {
+				return "", errorAt(s, start, "invalid digit grouping near %q", s[start:i])
+			}
+			b.WriteString(s[group:i])
+		}
+	}
+	return b.String(), nil
+}
+
+// EvalMoneyExpressionString evaluates expr like EvalMoneyExpression and
+// formats the result with FormatCents.
+func EvalMoneyExpressionString(expr string) (string, error) {
+	cents, err := EvalMoneyExpression(expr)
+	if err != nil {
+		return "", err
+	}
+	return FormatCents(cents, moneyDecimals), nil
+}
+
+// FormatCents renders an amount in minor units as a decimal string, so
+// -5 with two decimals becomes "-0.05".
+func FormatCents(cents int64, decimals int) string {
+	digits := strconv.FormatUint(absUint64(cents), 10)
+	if decimals > 0 {
+		if len(digits) <= decimals {
+			digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+	}
+	if cents < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+func evalMoney(expr string, decimals int, opts MoneyOptions) (int64, bool, error) {
+	if decimals < 0 || decimals > maxMoneyDecimals {
+		return 0, false, fmt.Errorf("money decimals must be between 0 and %d, got %d", maxMoneyDecimals, decimals)
+	}
+	if opts.Rounding < HalfAwayFromZero || opts.Rounding > Truncate {
+		return 0, false, fmt.Errorf("unknown rounding mode %d", opts.Rounding)
+	}
+	if len(opts.StripSymbols) > 0 {
+		var err error
+		if expr, err = stripSymbols(expr, opts.StripSymbols); err != nil {
+			return 0, false, err
+		}
+	}
+	toks, err := tokenize(expr, Options{})
+	if err != nil {
+		return 0, false, err
+	}
+	rpn, err := toRPN(toks, Options{})
+	if err != nil {
+		return 0, false, err
+	}
+	return evalRPNMoney(rpn, decimals, opts)
+}
+
+// EvalBoth parses expr once and evaluates it both in float64 and in exact
+// cents, so callers can check that the two agree beyond rounding.
+func EvalBoth(expr string) (float64, int64, error) {
+	toks, err := tokenize(expr, Options{})
+	if err != nil {
+		return 0, 0, err
+	}
+	rpn, err := toRPN(toks, Options{})
+	if err != nil {
+		return 0, 0, err
+	}
+	f, err := evalRPN(context.Background(), rpn, Options{})
+	if err != nil {
+		return 0, 0, err
+	}
+	cents, _, err := evalRPNMoney(rpn, moneyDecimals, MoneyOptions{})
+	if err != nil {
+		return 0, 0, err
+	}
+	return f, cents, nil
+}
+
+func stripSymbols(s string, symbols []rune) (string, error) {
+	var b strings.Builder
+	for i, r := range s {
+		if !slices.Contains(symbols, r) {
+			b.WriteRune(r)
+			continue
+		}
+		next := i + utf8.RuneLen(r)
+		prev, _ := utf8.DecodeLastRuneInString(s[:i])
+		afterOperand := i > 0 && prev < utf8.RuneSelf && (isIdentContinue(byte(prev)) || prev == '.')
+		if afterOperand || next >= len(s) || !isDigit(s[next]) && s[next] != '.' {
+			return "", errorAt(s, i, "currency symbol %q must directly precede a number", string(r))
+		}
+	}
+	return b.String(), nil
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+func parseCents(txt string, decimals int, allowExponent bool) (int64, error) {
+	if txt == "" || !isDigit(txt[0]) && txt[0] != '.' {
+		return 0, fmt.Errorf("constant %q is not allowed in money expressions", txt)
+	}
+	digits := strings.ReplaceAll(txt, "_", "")
+	if strings.ContainsAny(digits, "eE") {
+		if !allowExponent {
+			return 0, fmt.Errorf("scientific notation is not supported in money expressions: %q", txt)
+		}
+		var err error
+		if digits, err = expandExponent(digits); err != nil {
+			return 0, fmt.Errorf("%v in %q", err, txt)
+		}
+	}
+
+	whole, frac, _ := strings.Cut(digits, ".")
+	if len(frac) > decimals {
+		return 0, fmt.Errorf("too many decimal places in %q (max %d)", txt, decimals)
+	}
+	frac += strings.Repeat("0", decimals-len(frac))
+
+	var v int64
+	for _, c := range whole + frac {
+		var err error
+		if v, err = mulInt64(v, 10); err != nil {
+			return 0, err
+		}
+		if v, err = addInt64(v, int64(c-'0')); err != nil {
+			return 0, err
+		}
+	}
+	return v, nil
+}
+
+// expandExponent rewrites a literal such as 1.5e2 as the plain decimal
+// 150 by moving the decimal point, without a float round-trip.
+func expandExponent(s string) (string, error) {
+	i := strings.IndexAny(s, "eE")
+	mant, expText := s[:i], s[i+1:]
+	exp, err := strconv.Atoi(expText)
+	if err != nil || exp < -maxMoneyExponent || exp > maxMoneyExponent {
+		return "", fmt.Errorf("invalid exponent %q", expText)
+	}
+
+	whole, frac, _ := strings.Cut(mant, ".")
+	if exp >= 0 {
+		if exp > len(frac) {
+			frac += strings.Repeat("0", exp-len(frac))
+		}
+		whole, frac = whole+frac[:exp], frac[exp:]
+	} else {
+		if -exp > len(whole) {
+			whole = strings.Repeat("0", -exp-len(whole)) + whole
+		}
+		cut := len(whole) + exp
+		whole, frac = whole[:cut], whole[cut:]+frac
+	}
+	frac = strings.TrimRight(frac, "0")
+	if frac == "" {
+		return whole, nil
+	}
+	return whole + "." + frac, nil
+}
+
+func evalRPNMoney(rpn []Token, decimals int, opts MoneyOptions) (int64, bool, error) {
+	scale := pow10(decimals)
+	percentScale := scale * 100
+	var st []int64
+	rounded := false
+
+	div := func(a, b int64) (int64, error) {
+		if b != 0 && a%b != 0 {
+			rounded = true
+		}
+		return divRound(a, b, opts.Rounding)
+	}
+
+	// mulDiv computes x*y/d for the operation a op b, falling back to
+	// big.Int when x*y overflows and opts.PromoteOverflow is set or op is
+	// "/". An
+	// overflow is reported against op, a and b rather than the scaled
+	// intermediate product.
+	mulDiv := func(op string, a, b, x, y, d int64) (int64, error) {
+		p, err := mulInt64(x, y)
+		if err == nil {
+			return div(p, d)
+		}
+		if !opts.PromoteOverflow && op != "/" {
+			return 0, &OverflowError{Op: op, A: a, B: b}
+		}
+		q, r, fits, err := mulDivBig(x, y, d, opts.Rounding)
+		if err != nil {
+			return 0, err
+		}
+		if !fits {
+			return 0, &OverflowError{Op: op, A: a, B: b}
+		}
+		if r {
+			rounded = true
+		}
+		return q, nil
+	}
+
+	pop := func() (int64, error) {
+		if len(st) == 0 {
+			return 0, errors.New("not enough operands")
+		}
+		v := st[len(st)-1]
+		st = st[:len(st)-1]
+		return v, nil
+	}
+
+	for _, t := range rpn {
+		switch t.Typ {
+		case TNumber:
+			v, err := parseCents(t.Text, decimals, opts.AllowExponent)
+			if err != nil {
+				return 0, false, err
+			}
+			st = append(st, v)
+
+		case TFunc:
+			return 0, false, fmt.Errorf("function %q is not supported in money expressions", t.Text)
+
+		case TOp:
+			switch t.Text {
+			case "NEG":
+				a, err := pop()
+				if err != nil {
+					return 0, false, err
+				}
+				if a == math.MinInt64 {
+					return 0, false, &OverflowError{Op: "NEG", A: a}
+				}
+				st = append(st, -a)
+
+			case "POS":
+				a, err := pop()
+				if err != nil {
+					return 0, false, err
+				}
+				st = append(st, a)
+
+			case "+", "-", "*", "/", "%", "^":
+				b, err := pop()
+				if err != nil {
+					return 0, false, err
+				}
+				a, err := pop()
+				if err != nil {
+					return 0, false, err
+				}
+
+				var res int64
+				switch t.Text {
+				case "+":
+					res, err = addInt64(a, b)
+				case "-":
+					res, err = subInt64(a, b)
+				case "*":
+					res, err = mulDiv(t.Text, a, b, a, b, scale)
+				case "/":
+					if b == 0 {
+						return 0, false, errors.New("division by zero")
+					}
+					res, err = mulDiv(t.Text, a, b, a, scale, b)
+				case "%":
+					res, err = mulDiv(t.Text, a, b, a, b, percentScale)
+				case "^":
+					if b < 0 || b%scale != 0 {
+						return 0, false, fmt.Errorf("money exponent must be a non-negative integer, got %s", FormatCents(b, decimals))
+					}
+					n := b / scale
+					if n > maxMoneyExponent {
+						return 0, false, fmt.Errorf("money exponent %d exceeds limit %d", n, maxMoneyExponent)
+					}
+					res = scale
+					for ; n > 0 && err == nil; n-- {
+						res, err = mulDiv(t.Text, a, b, res, a, scale)
+					}
+				}
+				if err != nil {
+					return 0, false, err
+				}
+				st = append(st, res)
+
+			default:
+				return 0, false, fmt.Errorf("operator %q is not supported in money expressions", t.Text)
+			}
+
+		default:
+			return 0, false, fmt.Errorf("token %q is not supported in money expressions", t.Text)
+		}
+	}
+
+	if len(st) != 1 {
+		return 0, false, errors.New("expression error: extra values")
+	}
+	return st[0], rounded, nil
+}
+
+// OverflowError reports a fixed-point or integer operation whose result
+// does not fit in an int64. Op is "+", "-", "*", "/", "%", "^", "<<" or
+// "NEG"; B is unused for "NEG".
+type OverflowError struct {
+	Op   string
+	A, B int64
+}
+
+func (e *OverflowError) Error() string {
+	switch e.Op {
+	case "+":
+		return fmt.Sprintf("overflow while adding %d + %d", e.A, e.B)
+	case "-":
+		return fmt.Sprintf("overflow while subtracting %d - %d", e.A, e.B)
+	case "*":
+		return fmt.Sprintf("overflow while multiplying %d * %d", e.A, e.B)
+	case "/":
+		return fmt.Sprintf("overflow while dividing %d / %d", e.A, e.B)
+	case "%":
+		return fmt.Sprintf("overflow while taking %d %% %d", e.A, e.B)
+	case "^":
+		return fmt.Sprintf("overflow while raising %d ^ %d", e.A, e.B)
+	case "<<":
+		return fmt.Sprintf("overflow while shifting %d << %d", e.A, e.B)
+	case "NEG":
+		return fmt.Sprintf("overflow while negating %d", e.A)
+	}
+	return fmt.Sprintf("overflow in %s with %d and %d", e.Op, e.A, e.B)
+}
+
+func addInt64(a, b int64) (int64, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, &OverflowError{Op: "+", A: a, B: b}
+	}
+	return a + b, nil
+}
+
+func subInt64(a, b int64) (int64, error) {
+	if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+		return 0, &OverflowError{Op: "-", A: a, B: b}
+	}
+	return a - b, nil
+}
+
+func mulInt64(a, b int64) (int64, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+	p := a * b
+	if p/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, &OverflowError{Op: "*", A: a, B: b}
+	}
+	return p, nil
+}
+
+// divRound divides a by b, rounding the quotient according to mode.
+func divRound(a, b int64, mode RoundingMode) (int64, error) {
+	if b == 0 {
+		return 0, errors.New("division by zero")
+	}
+	if a == math.MinInt64 && b == -1 {
+		return 0, &OverflowError{Op: "/", A: a, B: b}
+	}
+	q, r := a/b, a%b
+	if r == 0 {
+		return q, nil
+	}
+
+	neg := (a < 0) != (b < 0)
+	ar, ab := absUint64(r), absUint64(b)
+	half := 0
+	if ar > ab-ar {
+		half = 1
+	} else if ar < ab-ar {
+		half = -1
+	}
+	up, err := roundsAway(mode, neg, half, q%2 != 0)
+	if err != nil {
+		return 0, err
+	}
+	if !up {
+		return q, nil
+	}
+	if neg {
+		return q - 1, nil
+	}
+	return q + 1, nil
+}
+
+// mulDivBig computes x*y/d in big.Int, rounds it according to mode and
+// reports whether a remainder was discarded and whether the rounded
+// quotient fits in an int64.
+func mulDivBig(x, y, d int64, mode RoundingMode) (q int64, rounded, fits bool, err error) {
+	if d == 0 {
+		return 0, false, false, errors.New("division by zero")
+	}
+	bd := big.NewInt(d)
+	bq, r := new(big.Int).QuoRem(new(big.Int).Mul(big.NewInt(x), big.NewInt(y)), bd, new(big.Int))
+	if r.Sign() != 0 {
+		neg := r.Sign() != bd.Sign()
+		twice := new(big.Int).Abs(r)
+		twice.Lsh(twice, 1)
+		half := twice.CmpAbs(bd)
+		up, err := roundsAway(mode, neg, half, bq.Bit(0) != 0)
+		if err != nil {
+			return 0, false, false, err
+		}
+		if up && neg {
+			bq.Sub(bq, big.NewInt(1))
+		} else if up {
+			bq.Add(bq, big.NewInt(1))
+		}
+	}
+	if !bq.IsInt64() {
+		return 0, false, false, nil
+	}
+	return bq.Int64(), r.Sign() != 0, true, nil
+}
+
+// roundsAway reports whether a truncated quotient should move one unit
+// away from zero. neg is the sign of the exact quotient, half compares the
+// discarded remainder with one half (-1, 0 or 1) and odd is the parity of
+// the truncated quotient.
+func roundsAway(mode RoundingMode, neg bool, half int, odd bool) (bool, error) {
+	switch mode {
+	case HalfAwayFromZero:
+		return half >= 0, nil
+	case HalfEven:
+		return half > 0 || (half == 0 && odd), nil
+	case HalfUp:
+		return half > 0 || (half == 0 && !neg), nil
+	case Floor:
+		return neg, nil
+	case Ceil:
+		return !neg, nil
+	case Truncate:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown rounding mode %d", mode)
+	}
+}
+
+func absUint64(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
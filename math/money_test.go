@@ -0,0 +1,523 @@
+package math
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestEvalMoneyExpression(t *testing.T) {
+	cases := []struct {
+		expr string
+		want int64
+	}{
+		{"12.5*(3-1)/4", 625},
+		{"0.1+0.2", 30},
+		{"10/3", 333},
+		{"-10/3", -333},
+		{"2/3", 67},
+		{"0.05/2", 3},
+		{"-0.05/2", -3},
+		{"200%10", 2000},
+		{"19.99*3", 5997},
+		{"1_000.50-0.50", 100000},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoneyExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %d want %d", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestEvalMoneyExpression_Errors(t *testing.T) {
+	cases := []string{
+		"1.234",
+		"1e2",
+		"2^0.5",
+		"sqrt(4)",
+		"1/0",
+		"pi*2",
+		"92233720368547758.07+1",
+		"50000000000000000*2",
+	}
+
+	for _, expr := range cases {
+		if _, err := EvalMoneyExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalMoneyExpressionScale(t *testing.T) {
+	cases := []struct {
+		expr     string
+		decimals int
+		want     int64
+	}{
+		{"1.234", 3, 1234},
+		{"1.234+0.1", 3, 1334},
+		{"10/3", 3, 3333},
+		{"2/3", 3, 667},
+		{"0.001/2", 3, 1},
+		{"-0.001/2", 3, -1},
+		{"1.5*1.5", 3, 2250},
+		{"200%10", 3, 20000},
+		{"12", 0, 12},
+		{"0.00000001*3", 8, 3},
+		{"1.5/4", 16, 3750000000000000},
+		{"100/3", 16, 333333333333333333},
+		{"-2/3", 16, -6666666666666667},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoneyExpressionScale(tc.expr, tc.decimals)
+		if err != nil {
+			t.Fatalf("unexpected error for %q at %d decimals: %v", tc.expr, tc.decimals, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q at %d decimals: got %d want %d", tc.expr, tc.decimals, got, tc.want)
+		}
+	}
+
+	if _, err := EvalMoneyExpressionScale("1.2345", 3); err == nil {
+		t.Fatalf("expected error for too many decimals")
+	}
+	if _, err := EvalMoneyExpressionScale("1", 17); err == nil {
+		t.Fatalf("expected error for unsupported scale")
+	}
+}
+
+func TestEvalMoneyExpressionWithOptions_Rounding(t *testing.T) {
+	cases := []struct {
+		expr string
+		mode RoundingMode
+		want int64
+	}{
+		{"10/3", HalfAwayFromZero, 333},
+		{"10/3", HalfEven, 333},
+		{"10/3", Ceil, 334},
+		{"-10/3", Floor, -334},
+		{"-10/3", Truncate, -333},
+		{"0.05/2", HalfAwayFromZero, 3},
+		{"0.05/2", HalfEven, 2},
+		{"0.05/2", HalfUp, 3},
+		{"-0.05/2", HalfAwayFromZero, -3},
+		{"-0.05/2", HalfEven, -2},
+		{"-0.05/2", HalfUp, -2},
+		{"-0.05/2", Floor, -3},
+		{"-0.05/2", Ceil, -2},
+		{"-0.05/2", Truncate, -2},
+		{"-0.07/2", HalfEven, -4},
+		{"-0.07/2", HalfUp, -3},
+		{"-0.07/2", HalfAwayFromZero, -4},
+		{"0.07/2", HalfEven, 4},
+		{"0.01*0.5", HalfAwayFromZero, 1},
+		{"0.01*0.5", HalfEven, 0},
+		{"1%0.5", HalfEven, 0},
+		{"1%0.5", HalfAwayFromZero, 1},
+		{"2/3", Floor, 66},
+		{"2/3", Truncate, 66},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoneyExpressionWithOptions(tc.expr, MoneyOptions{Rounding: tc.mode})
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q with mode %d: got %d want %d", tc.expr, tc.mode, got, tc.want)
+		}
+	}
+
+	if _, err := EvalMoneyExpressionWithOptions("9/3", MoneyOptions{Rounding: RoundingMode(99)}); err == nil {
+		t.Fatalf("expected error for unknown rounding mode")
+	}
+}
+
+func TestFormatCents(t *testing.T) {
+	cases := []struct {
+		cents    int64
+		decimals int
+		want     string
+	}{
+		{-1205, 2, "-12.05"},
+		{-5, 2, "-0.05"},
+		{0, 2, "0.00"},
+		{5, 2, "0.05"},
+		{100, 2, "1.00"},
+		{1234, 3, "1.234"},
+		{42, 0, "42"},
+		{-42, 0, "-42"},
+		{math.MinInt64, 2, "-92233720368547758.08"},
+	}
+
+	for _, tc := range cases {
+		if got := FormatCents(tc.cents, tc.decimals); got != tc.want {
+			t.Fatalf("FormatCents(%d, %d) = %q, want %q", tc.cents, tc.decimals, got, tc.want)
+		}
+	}
+}
+
+func TestEvalMoneyExpressionString(t *testing.T) {
+	got, err := EvalMoneyExpressionString("10/3 - 20")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "-16.67" {
+		t.Fatalf("wrong result: got %q want %q", got, "-16.67")
+	}
+
+	if _, err := EvalMoneyExpressionString("1/0"); err == nil {
+		t.Fatalf("expected error for division by zero")
+	}
+}
+
+func TestEvalMoneyExpressionGrouped(t *testing.T) {
+	cases := []struct {
+		expr string
+		want int64
+	}{
+		{"1,200.50+10", 121050},
+		{"1,000,000", 100000000},
+		{"999", 99900},
+		{"12,345.6 - 0.6", 1234500},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoneyExpressionGrouped(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %d want %d", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"1,2345", "1,20", "1234,567", "1,000,00"} {
+		if _, err := EvalMoneyExpressionGrouped(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalMoneyExpressionWithOptions_StripSymbols(t *testing.T) {
+	opts := MoneyOptions{StripSymbols: []rune{'$', '€', '£'}}
+	cases := []struct {
+		expr string
+		want int64
+	}{
+		{"$19.99 + $5", 2499},
+		{"€10*3", 3000},
+		{"-£.50", -50},
+		{"($1+$2)/2", 150},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoneyExpressionWithOptions(tc.expr, opts)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %d want %d", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"5$", "5 $ 5", "$ 5", "¥5", "10$5", "1.$5", "x$5", "$$5"} {
+		if _, err := EvalMoneyExpressionWithOptions(expr, opts); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+	if _, err := EvalMoneyExpression("$5"); err == nil {
+		t.Fatalf("expected symbols to be rejected without the option")
+	}
+}
+
+func TestEvalMoneyExpressionWithOptions_AllowExponent(t *testing.T) {
+	opts := MoneyOptions{AllowExponent: true}
+	cases := []struct {
+		expr string
+		want int64
+	}{
+		{"1.5e2", 15000},
+		{"1.5E+2", 15000},
+		{"-1.5e2", -15000},
+		{"25e-1", 250},
+		{"1e-2", 1},
+		{".5e1", 500},
+		{"1.50e0 + 1", 250},
+		{"1.2345e2", 12345},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoneyExpressionWithOptions(tc.expr, opts)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %d want %d", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"1.2345e1", "1e-3", "1e20000"} {
+		if _, err := EvalMoneyExpressionWithOptions(expr, opts); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+	if _, err := EvalMoneyExpression("1.5e2"); err == nil {
+		t.Fatalf("expected scientific notation to be rejected without the option")
+	}
+}
+
+func TestEvalMoneyExpression_Negative(t *testing.T) {
+	cases := []struct {
+		expr string
+		want int64
+	}{
+		{"-12.50", -1250},
+		{"-0.00", 0},
+		{"0 - 0.00", 0},
+		{"-.05", -5},
+		{"--12.50", 1250},
+		{"-12.50 + 2.50", -1000},
+		{"-92233720368547758.07", math.MinInt64 + 1},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoneyExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %d want %d", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"-92233720368547758.08", "-92233720368547758.07-0.02", "-(-92233720368547758.07-0.01)"} {
+		if _, err := EvalMoneyExpression(expr); err == nil {
+			t.Fatalf("expected overflow error for %q", expr)
+		}
+	}
+}
+
+func TestEvalMoneyExpressionScale_MinorUnits(t *testing.T) {
+	cases := []struct {
+		expr     string
+		cents    int64
+		microUSD int64
+	}{
+		{"12.50*2", 2500, 25000000},
+		{"10/3", 333, 3333333},
+		{"0.01/4", 0, 2500},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoneyExpressionScale(tc.expr, 2)
+		if err != nil {
+			t.Fatalf("unexpected error for %q at 2 digits: %v", tc.expr, err)
+		}
+		if got != tc.cents {
+			t.Fatalf("wrong result for %q at 2 digits: got %d want %d", tc.expr, got, tc.cents)
+		}
+		got, err = EvalMoneyExpressionScale(tc.expr, 6)
+		if err != nil {
+			t.Fatalf("unexpected error for %q at 6 digits: %v", tc.expr, err)
+		}
+		if got != tc.microUSD {
+			t.Fatalf("wrong result for %q at 6 digits: got %d want %d", tc.expr, got, tc.microUSD)
+		}
+	}
+
+	got, err := EvalMoneyExpressionScale("2.50*0.0012", 6)
+	if err != nil || got != 3000 {
+		t.Fatalf("wrong result for sub-cent rate: got %d, %v want 3000", got, err)
+	}
+	if _, err := EvalMoneyExpressionScale("2.50*0.0012", 2); err == nil {
+		t.Fatalf("expected error for sub-cent literal at 2 digits")
+	}
+	if _, err := EvalMoneyExpressionScale("1", -1); err == nil {
+		t.Fatalf("expected error for negative digits")
+	}
+}
+
+func TestEvalMoneyAudit(t *testing.T) {
+	cases := []struct {
+		expr    string
+		want    int64
+		rounded bool
+	}{
+		{"10/3", 333, true},
+		{"9/3", 300, false},
+		{"0.05/2", 3, true},
+		{"19.99*3", 5997, false},
+		{"1.99*0.5", 100, true},
+		{"200%10", 2000, false},
+		{"0.99%10", 10, true},
+		{"1+2", 300, false},
+	}
+
+	for _, tc := range cases {
+		got, rounded, err := EvalMoneyAudit(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want || rounded != tc.rounded {
+			t.Fatalf("wrong result for %q: got (%d, %v) want (%d, %v)", tc.expr, got, rounded, tc.want, tc.rounded)
+		}
+	}
+
+	if _, _, err := EvalMoneyAudit("1/0"); err == nil {
+		t.Fatalf("expected error for division by zero")
+	}
+}
+
+func TestEvalMoneyExpression_Power(t *testing.T) {
+	cases := []struct {
+		expr string
+		want int64
+	}{
+		{"1.10^2", 121},
+		{"2^3", 800},
+		{"1.10^3", 133},
+		{"100*1.05^2", 11000},
+		{"5^0", 100},
+		{"-2^3", -800},
+		{"0.5^2", 25},
+		{"1^10000", 100},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoneyExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %d want %d", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"2^0.5", "2^-1", "10^20", "1^10001"} {
+		if _, err := EvalMoneyExpression(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestEvalMoneyExpression_OverflowError(t *testing.T) {
+	cases := []struct {
+		expr string
+		want OverflowError
+		msg  string
+	}{
+		{"90000000000000000*2", OverflowError{Op: "*", A: 9000000000000000000, B: 200}, "overflow while multiplying 9000000000000000000 * 200"},
+		{"92233720368547758.07+0.01", OverflowError{Op: "+", A: math.MaxInt64, B: 1}, "overflow while adding 9223372036854775807 + 1"},
+		{"-92233720368547758.07-0.02", OverflowError{Op: "-", A: -math.MaxInt64, B: 2}, "overflow while subtracting -9223372036854775807 - 2"},
+		{"90000000000000000/0.5", OverflowError{Op: "/", A: 9000000000000000000, B: 50}, "overflow while dividing 9000000000000000000 / 50"},
+		{"90000000000000000%300", OverflowError{Op: "%", A: 9000000000000000000, B: 30000}, "overflow while taking 9000000000000000000 % 30000"},
+		{"90000000000000000^2", OverflowError{Op: "^", A: 9000000000000000000, B: 200}, "overflow while raising 9000000000000000000 ^ 200"},
+	}
+
+	for _, tc := range cases {
+		_, err := EvalMoneyExpression(tc.expr)
+		var oe *OverflowError
+		if !errors.As(err, &oe) {
+			t.Fatalf("expected OverflowError for %q, got %v", tc.expr, err)
+		}
+		if *oe != tc.want {
+			t.Fatalf("wrong overflow for %q: got %+v want %+v", tc.expr, *oe, tc.want)
+		}
+		if err.Error() != tc.msg {
+			t.Fatalf("wrong message for %q: got %q want %q", tc.expr, err.Error(), tc.msg)
+		}
+	}
+}
+
+func TestEvalMoneyExpressionWithOptions_PromoteOverflow(t *testing.T) {
+	expr := "90000000000000000*0.5"
+	if _, err := EvalMoneyExpression(expr); err == nil {
+		t.Fatalf("expected overflow for %q without PromoteOverflow", expr)
+	}
+
+	opts := MoneyOptions{PromoteOverflow: true}
+	got, err := EvalMoneyExpressionWithOptions(expr, opts)
+	if err != nil {
+		t.Fatalf("unexpected error for %q: %v", expr, err)
+	}
+	if got != 4500000000000000000 {
+		t.Fatalf("wrong result for %q: got %d", expr, got)
+	}
+
+	got, err = EvalMoneyExpressionWithOptions("-90000000000000000.01*0.5", MoneyOptions{PromoteOverflow: true, Rounding: Floor})
+	if err != nil || got != -4500000000000000001 {
+		t.Fatalf("wrong promoted rounding: got %d, %v", got, err)
+	}
+
+	for expr, op := range map[string]string{
+		"90000000000000000*2":   "*",
+		"90000000000000000/0.5": "/",
+		"90000000000000000%300": "%",
+	} {
+		_, err = EvalMoneyExpressionWithOptions(expr, opts)
+		var oe *OverflowError
+		if !errors.As(err, &oe) || oe.Op != op {
+			t.Fatalf("expected %q OverflowError for %q when the result does not fit, got %v", op, expr, err)
+		}
+	}
+}
+
+func TestEvalMoneyExpression_UnaryPlus(t *testing.T) {
+	cases := []struct {
+		expr string
+		want int64
+	}{
+		{"+12.50", 1250},
+		{"++12.50", 1250},
+		{"+-12.50", -1250},
+		{"-+12.50", -1250},
+		{"1 - +0.50", 50},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalMoneyExpression(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %d want %d", tc.expr, got, tc.want)
+		}
+	}
+
+	got, err := EvalMoneyExpressionWithOptions("+$5", MoneyOptions{StripSymbols: []rune{'$'}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 500 {
+		t.Fatalf("wrong result for +$5: got %d want 500", got)
+	}
+}
+
+func TestEvalBoth(t *testing.T) {
+	f, cents, err := EvalBoth("12.5*(3-1)/4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f != 6.25 || cents != 625 {
+		t.Fatalf("wrong results: got %v and %d cents", f, cents)
+	}
+	if math.Round(f*100) != float64(cents) {
+		t.Fatalf("float %v and cents %d disagree", f, cents)
+	}
+
+	f, cents, err = EvalBoth("10/3")
+	if err != nil || cents != 333 || math.Abs(f*100-float64(cents)) >= 0.5 {
+		t.Fatalf("wrong results for 10/3: got %v, %d, %v", f, cents, err)
+	}
+
+	if _, _, err := EvalBoth("sqrt(4)"); err == nil {
+		t.Fatalf("expected money evaluation to reject functions")
+	}
+}
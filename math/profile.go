@@ -0,0 +1,63 @@
+package math
+
+import "fmt"
+
+// Profile is a named bundle of precedence and percent settings that
+// emulates a family of calculators.
+type Profile int
+
+const (
+	// ProfileLegacy is this package's original behavior: -2^2 is 4,
+	// 2^3^2 is 512 and "%" is always the binary percent operator.
+	ProfileLegacy Profile = iota
+	// ProfileTI follows TI graphing calculators: -2^2 is -4 and powers
+	// chain left to right, so 2^3^2 is 64.
+	ProfileTI
+	// ProfileCasio follows Casio scientific calculators: -2^2 is -4,
+	// 2^3^2 is 512 and "200+10%" adds ten percent of 200.
+	ProfileCasio
+	// ProfileSpreadsheet follows spreadsheet formulas: -2^2 is 4, 2^3^2 is
+	// 64 and "10%" is simply 0.1.
+	ProfileSpreadsheet
+)
+
+func (p Profile) String() string {
+	switch p {
+	case ProfileLegacy:
+		return "legacy"
+	case ProfileTI:
+		return "TI"
+	case ProfileCasio:
+		return "Casio"
+	case ProfileSpreadsheet:
+		return "spreadsheet"
+	default:
+		return fmt.Sprintf("Profile(%d)", int(p))
+	}
+}
+
+// Options returns the evaluation options p stands for.
+func (p Profile) Options() (Options, error) {
+	switch p {
+	case ProfileLegacy:
+		return Options{Unary: UnaryAbovePower}, nil
+	case ProfileTI:
+		return Options{Unary: UnaryBelowPower, PowerLeftAssoc: true}, nil
+	case ProfileCasio:
+		return Options{Unary: UnaryBelowPower, PercentOfSum: true}, nil
+	case ProfileSpreadsheet:
+		return Options{Unary: UnaryAbovePower, PowerLeftAssoc: true, PostfixPercent: true}, nil
+	default:
+		return Options{}, fmt.Errorf("unknown profile %d", int(p))
+	}
+}
+
+// EvalExpressionProfile evaluates expr the way the calculators described
+// by profile would.
+func EvalExpressionProfile(expr string, profile Profile) (float64, error) {
+	opts, err := profile.Options()
+	if err != nil {
+		return 0, err
+	}
+	return EvalExpressionWithOptions(expr, opts)
+}
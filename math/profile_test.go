@@ -0,0 +1,40 @@
+package math
+
+import "testing"
+
+func TestEvalExpressionProfile(t *testing.T) {
+	cases := []struct {
+		expr    string
+		profile Profile
+		want    float64
+	}{
+		{"-2^2", ProfileLegacy, 4},
+		{"-2^2", ProfileTI, -4},
+		{"-2^2", ProfileCasio, -4},
+		{"-2^2", ProfileSpreadsheet, 4},
+		{"2^3^2", ProfileLegacy, 512},
+		{"2^3^2", ProfileTI, 64},
+		{"2^3^2", ProfileCasio, 512},
+		{"2^3^2", ProfileSpreadsheet, 64},
+		{"2^-2", ProfileTI, 0.25},
+		{"-2^-2", ProfileTI, -0.25},
+		{"3*-2^2", ProfileCasio, -12},
+		{"200+10%", ProfileCasio, 220},
+		{"200+10%", ProfileSpreadsheet, 200.1},
+		{"200 % 10", ProfileLegacy, 20},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpressionProfile(tc.expr, tc.profile)
+		if err != nil {
+			t.Fatalf("unexpected error for %q in %v: %v", tc.expr, tc.profile, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q in %v: got %v want %v", tc.expr, tc.profile, got, tc.want)
+		}
+	}
+
+	if _, err := EvalExpressionProfile("1", Profile(99)); err == nil {
+		t.Fatalf("expected error for unknown profile")
+	}
+}
@@ -0,0 +1,120 @@
+package math
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Scope holds variables shared by the statements of a program.
+type Scope struct {
+	Vars map[string]float64
+}
+
+// NewScope returns an empty Scope.
+func NewScope() *Scope {
+	return &Scope{Vars: map[string]float64{}}
+}
+
+func splitStatements(src string) ([]string, error) {
+	var stmts []string
+	depth := 0
+	start := 0
+
+	for i := 0; i < len(src); i++ {
+		switch src[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ';':
+			if depth == 0 {
+				stmts = append(stmts, src[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if last := src[start:]; strings.TrimSpace(last) != "" || len(stmts) == 0 {
+		stmts = append(stmts, last)
+	}
+
+	for _, stmt := range stmts {
+		if strings.TrimSpace(stmt) == "" {
+			return nil, errors.New("empty statement")
+		}
+	}
+	return stmts, nil
+}
+
+// splitAssignment reports the target of a statement of the form
+// "name = expr" and the expression to its right. Only a leading identifier
+// followed by a single "=" counts, so "x == 1" stays a comparison.
+func splitAssignment(stmt string) (name, rhs string, ok bool) {
+	s := strings.TrimLeft(stmt, " \t\r\n")
+	if s == "" || !isIdentStart(s[0]) {
+		return "", stmt, false
+	}
+	i := 1
+	for i < len(s) && isIdentContinue(s[i]) {
+		i++
+	}
+	name = strings.ToLower(s[:i])
+	rest := strings.TrimLeft(s[i:], " \t\r\n")
+	if !strings.HasPrefix(rest, "=") || strings.HasPrefix(rest, "==") {
+		return "", stmt, false
+	}
+	return name, rest[1:], true
+}
+
+// EvalProgram evaluates semicolon-separated statements in order and returns
+// the value of the last one. A statement may assign with "name = expr";
+// the variable is then visible to later statements and kept in scope. A
+// nil scope starts empty. A trailing ";" is allowed.
+func EvalProgram(src string, scope *Scope) (float64, error) {
+	return evalProgram(src, scope, nil)
+}
+
+// EvalProgramCallback evaluates semicolon-separated statements in order,
+// calling fn with each statement's index and result, and returns the value
+// of the last statement.
+func EvalProgramCallback(src string, fn func(index int, value float64)) (float64, error) {
+	return evalProgram(src, nil, fn)
+}
+
+func evalProgram(src string, scope *Scope, fn func(index int, value float64)) (float64, error) {
+	stmts, err := splitStatements(src)
+	if err != nil {
+		return 0, err
+	}
+	if scope == nil {
+		scope = NewScope()
+	}
+	if scope.Vars == nil {
+		scope.Vars = map[string]float64{}
+	}
+
+	var last float64
+	for i, stmt := range stmts {
+		name, rhs, assign := splitAssignment(stmt)
+		if assign {
+			if _, ok := constants[name]; ok {
+				return 0, fmt.Errorf("cannot assign to constant %q", name)
+			}
+			if strings.TrimSpace(rhs) == "" {
+				return 0, fmt.Errorf("assignment to %s has no expression", name)
+			}
+		}
+		v, err := EvalExpressionWithOptions(rhs, Options{Vars: scope.Vars})
+		if err != nil {
+			return 0, err
+		}
+		if assign {
+			scope.Vars[name] = v
+		}
+		if fn != nil {
+			fn(i, v)
+		}
+		last = v
+	}
+	return last, nil
+}
@@ -0,0 +1,122 @@
+package math
+
+import "testing"
+
+func TestEvalProgram(t *testing.T) {
+	cases := []struct {
+		src  string
+		want float64
+	}{
+		{"1+1; 2+2", 4},
+		{"2+2; 3+3", 6},
+		{"1+1;", 2},
+		{"max(1, 2); 5", 5},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalProgram(tc.src, nil)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.src, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.src, got, tc.want)
+		}
+	}
+
+	for _, src := range []string{"", ";", "1+1;;", "1+1; 2*", "(1;2)"} {
+		if _, err := EvalProgram(src, nil); err == nil {
+			t.Fatalf("expected error for %q", src)
+		}
+	}
+}
+
+func TestEvalProgramCallback(t *testing.T) {
+	var indexes []int
+	var values []float64
+
+	got, err := EvalProgramCallback("1+1; max(2, 3)*2; 10/4", func(index int, value float64) {
+		indexes = append(indexes, index)
+		values = append(values, value)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 2.5 {
+		t.Fatalf("wrong result: got %v want 2.5", got)
+	}
+
+	wantValues := []float64{2, 6, 2.5}
+	if len(values) != len(wantValues) {
+		t.Fatalf("wrong callback count: got %d want %d", len(values), len(wantValues))
+	}
+	for i := range wantValues {
+		if indexes[i] != i || values[i] != wantValues[i] {
+			t.Fatalf("wrong callback %d: got (%d, %v) want (%d, %v)", i, indexes[i], values[i], i, wantValues[i])
+		}
+	}
+}
+
+func TestEvalProgramCallback_Errors(t *testing.T) {
+	calls := 0
+	if _, err := EvalProgramCallback("1+1; 2*; 3", func(int, float64) { calls++ }); err == nil {
+		t.Fatalf("expected error for bad statement")
+	}
+	if calls != 1 {
+		t.Fatalf("callback should stop at the failing statement, got %d calls", calls)
+	}
+
+	if _, err := EvalProgramCallback("1;;2", nil); err == nil {
+		t.Fatalf("expected error for empty statement")
+	}
+}
+
+func TestEvalProgram_Assignment(t *testing.T) {
+	scope := NewScope()
+	got, err := EvalProgram("x = 5; y = x*2; y+1", scope)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 11 {
+		t.Fatalf("wrong result: got %v want 11", got)
+	}
+	if scope.Vars["x"] != 5 || scope.Vars["y"] != 10 {
+		t.Fatalf("wrong scope: %v", scope.Vars)
+	}
+
+	got, err = EvalProgram("x = x + 1; x == 6", scope)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 1 || scope.Vars["x"] != 6 {
+		t.Fatalf("reassignment failed: got %v, x=%v", got, scope.Vars["x"])
+	}
+
+	got, err = EvalProgram("a = 2; b = 3; a*b", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 6 {
+		t.Fatalf("wrong result: got %v want 6", got)
+	}
+
+	got, err = EvalProgram("X = 5; X + x", nil)
+	if err != nil {
+		t.Fatalf("unexpected error for a mixed-case variable: %v", err)
+	}
+	if got != 10 {
+		t.Fatalf("wrong result: got %v want 10", got)
+	}
+
+	for _, src := range []string{"b=", "b =  ;", "a = 1; b = "} {
+		_, err := EvalProgram(src, nil)
+		if err == nil || err.Error() != "assignment to b has no expression" {
+			t.Fatalf("wrong error for %q: %v", src, err)
+		}
+	}
+
+	for _, src := range []string{"y = z + 1", "z; z = 1", "pi = 3", "PI = 3; PI", "Tau = 1", "1 = 2", "x = ", "2 + x = 1"} {
+		if _, err := EvalProgram(src, nil); err == nil {
+			t.Fatalf("expected error for %q", src)
+		}
+	}
+}
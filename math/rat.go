@@ -0,0 +1,150 @@
+package math
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// maxRatExponent bounds the magnitude of "^" exponents in rational mode,
+// whose results grow with the exponent and are computed exactly.
+const maxRatExponent = 10000
+
+// maxRatBits bounds the estimated size of a "^" result in rational mode,
+// so nested powers such as (3^10000)^10000 fail fast instead of exhausting
+// memory.
+const maxRatBits = 1 << 20
+
+// EvalExpressionRat evaluates expr exactly with big.Rat arithmetic. It
+// supports + - * / %, unary signs and ^ with an integer exponent. Functions
+// and named constants have no exact rational value and are rejected.
+func EvalExpressionRat(expr string) (*big.Rat, error) {
+	toks, err := tokenize(expr, Options{})
+	if err != nil {
+		return nil, err
+	}
+	rpn, err := toRPN(toks, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return evalRPNRat(rpn)
+}
+
+func evalRPNRat(rpn []Token) (*big.Rat, error) {
+	var st []*big.Rat
+
+	pop := func() (*big.Rat, error) {
+		if len(st) == 0 {
+			return nil, errors.New("not enough operands")
+		}
+		v := st[len(st)-1]
+		st = st[:len(st)-1]
+		return v, nil
+	}
+
+	for _, t := range rpn {
+		switch t.Typ {
+		case TNumber:
+			if !isDigit(t.Text[0]) && t.Text[0] != '.' {
+				return nil, fmt.Errorf("constant %q has no exact rational value", t.Text)
+			}
+			v, ok := new(big.Rat).SetString(strings.ReplaceAll(t.Text, "_", ""))
+			if !ok {
+				return nil, fmt.Errorf("failed to parse number %q", t.Text)
+			}
+			st = append(st, v)
+
+		case TFunc:
+			return nil, fmt.Errorf("function %q is not supported in rational mode", t.Text)
+
+		case TOp:
+			switch t.Text {
+			case "NEG":
+				a, err := pop()
+				if err != nil {
+					return nil, err
+				}
+				st = append(st, new(big.Rat).Neg(a))
+
+			case "POS":
+				a, err := pop()
+				if err != nil {
+					return nil, err
+				}
+				st = append(st, a)
+
+			case "+", "-", "*", "/", "%", "^":
+				b, err := pop()
+				if err != nil {
+					return nil, err
+				}
+				a, err := pop()
+				if err != nil {
+					return nil, err
+				}
+
+				res := new(big.Rat)
+				switch t.Text {
+				case "+":
+					res.Add(a, b)
+				case "-":
+					res.Sub(a, b)
+				case "*":
+					res.Mul(a, b)
+				case "/":
+					if b.Sign() == 0 {
+						return nil, errors.New("division by zero")
+					}
+					res.Quo(a, b)
+				case "%":
+					res.Mul(a, b)
+					res.Quo(res, big.NewRat(100, 1))
+				case "^":
+					if res, err = powRat(a, b); err != nil {
+						return nil, err
+					}
+				}
+				st = append(st, res)
+
+			default:
+				return nil, fmt.Errorf("operator %q is not supported in rational mode", t.Text)
+			}
+
+		default:
+			return nil, fmt.Errorf("token %q is not supported in rational mode", t.Text)
+		}
+	}
+
+	if len(st) != 1 {
+		return nil, errors.New("expression error: extra values")
+	}
+	return st[0], nil
+}
+
+func powRat(x, y *big.Rat) (*big.Rat, error) {
+	if !y.IsInt() || !y.Num().IsInt64() {
+		return nil, errors.New("rational mode only supports integer exponents")
+	}
+	n := y.Num().Int64()
+	if n > maxRatExponent || n < -maxRatExponent {
+		return nil, fmt.Errorf("rational exponent %d exceeds limit %d", n, maxRatExponent)
+	}
+	if n < 0 && x.Sign() == 0 {
+		return nil, errors.New("division by zero")
+	}
+
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	if bits := int64(max(x.Num().BitLen(), x.Denom().BitLen())) * n; bits > maxRatBits {
+		return nil, fmt.Errorf("overflow: rational power would need about %d bits, limit is %d", bits, maxRatBits)
+	}
+	num := new(big.Int).Exp(x.Num(), big.NewInt(n), nil)
+	den := new(big.Int).Exp(x.Denom(), big.NewInt(n), nil)
+	if neg {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
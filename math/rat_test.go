@@ -0,0 +1,40 @@
+package math
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestEvalExpressionRat(t *testing.T) {
+	cases := []struct {
+		expr string
+		want *big.Rat
+	}{
+		{"1/3+1/6", big.NewRat(1, 2)},
+		{"2/4", big.NewRat(1, 2)},
+		{"0.25", big.NewRat(1, 4)},
+		{"0.1+0.2", big.NewRat(3, 10)},
+		{"(2/3)^3", big.NewRat(8, 27)},
+		{"2^-3", big.NewRat(1, 8)},
+		{"-(1/3)*3", big.NewRat(-1, 1)},
+		{"50%1", big.NewRat(1, 2)},
+		{"1.5e2", big.NewRat(150, 1)},
+		{"1^10000", big.NewRat(1, 1)},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalExpressionRat(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got.Cmp(tc.want) != 0 {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"sqrt(2)", "pi", "2^(1/2)", "1/0", "0^-1", "1<2", "2^1e18", "2^-10001", "2^-9223372036854775808", "(3^10000)^10000", "((3^10000)^10000)^10000", "(1/3^10000)^-10000"} {
+		if _, err := EvalExpressionRat(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package math
+
+import (
+	"math"
+	"strconv"
+)
+
+// resultDigits is the number of significant digits Result.String shows
+// for non-integers, enough for a REPL without float noise such as
+// 0.30000000000000004.
+const resultDigits = 10
+
+// maxExactInt is 2^53, above which float64 cannot tell neighboring
+// integers apart.
+const maxExactInt = 1 << 53
+
+// Result is an evaluated value that knows whether it is a whole number.
+type Result struct {
+	Value float64
+}
+
+// EvalExpressionResult is like EvalExpression but wraps the value in a
+// Result for display.
+func EvalExpressionResult(expr string) (Result, error) {
+	v, err := EvalExpression(expr)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Value: v}, nil
+}
+
+// IsInt reports whether the value is a finite whole number.
+func (r Result) IsInt() bool {
+	return !math.IsInf(r.Value, 0) && r.Value == math.Trunc(r.Value)
+}
+
+// String prints whole numbers up to 2^53 without a fractional part, so
+// 4/2 is "2", and anything else with up to resultDigits significant
+// digits, so 1/3 is "0.3333333333". Negative zero prints as "0".
+func (r Result) String() string {
+	if r.Value == 0 {
+		return "0"
+	}
+	if r.IsInt() && math.Abs(r.Value) <= maxExactInt {
+		return strconv.FormatFloat(r.Value, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(r.Value, 'g', resultDigits, 64)
+}
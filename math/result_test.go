@@ -0,0 +1,39 @@
+package math
+
+import "testing"
+
+func TestEvalExpressionResult(t *testing.T) {
+	cases := []struct {
+		expr  string
+		isInt bool
+		want  string
+	}{
+		{"4/2", true, "2"},
+		{"2/4", false, "0.5"},
+		{"1/3", false, "0.3333333333"},
+		{"0.1+0.2", false, "0.3"},
+		{"-6", true, "-6"},
+		{"-0", true, "0"},
+		{"2^40", true, "1099511627776"},
+		{"10^21", true, "1e+21"},
+		{"1/0", false, "+Inf"},
+		{"nan", false, "NaN"},
+	}
+
+	for _, tc := range cases {
+		r, err := EvalExpressionResult(tc.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if r.IsInt() != tc.isInt {
+			t.Fatalf("wrong IsInt for %q: got %v want %v", tc.expr, r.IsInt(), tc.isInt)
+		}
+		if got := r.String(); got != tc.want {
+			t.Fatalf("wrong string for %q: got %q want %q", tc.expr, got, tc.want)
+		}
+	}
+
+	if _, err := EvalExpressionResult("2+"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -0,0 +1,26 @@
+package math
+
+import (
+	"context"
+	"fmt"
+)
+
+// EvalExpressionTrace evaluates expr like EvalExpression and also returns
+// a log of each RPN step, such as "push 2" or "apply + -> 5". On error the
+// log holds the steps that ran before it.
+func EvalExpressionTrace(expr string) (float64, []string, error) {
+	var steps []string
+	opts := Options{
+		trace: func(t Token, stack []float64) {
+			top := stack[len(stack)-1]
+			switch t.Typ {
+			case TNumber, TPercent, TVar:
+				steps = append(steps, fmt.Sprintf("push %v", top))
+			default:
+				steps = append(steps, fmt.Sprintf("apply %s -> %v", t.Text, top))
+			}
+		},
+	}
+	v, err := evalExpression(context.Background(), expr, opts)
+	return v, steps, err
+}
@@ -0,0 +1,36 @@
+package math
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvalExpressionTrace(t *testing.T) {
+	got, steps, err := EvalExpressionTrace("2+3*-4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != -10 {
+		t.Fatalf("wrong result: got %v want -10", got)
+	}
+
+	want := []string{
+		"push 2",
+		"push 3",
+		"push 4",
+		"apply NEG -> -4",
+		"apply * -> -12",
+		"apply + -> -10",
+	}
+	if strings.Join(steps, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("wrong trace:\n%s\nwant:\n%s", strings.Join(steps, "\n"), strings.Join(want, "\n"))
+	}
+
+	_, steps, err = EvalExpressionTrace("max(1, 2) + foo(3)")
+	if err == nil {
+		t.Fatalf("expected error for unknown function")
+	}
+	if len(steps) != 4 || steps[2] != "apply max -> 2" {
+		t.Fatalf("wrong partial trace: %q", steps)
+	}
+}
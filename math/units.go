@@ -0,0 +1,15 @@
+package math
+
+import "strings"
+
+// EvalWithUnits evaluates expr with unit names bound to conversion factors,
+// reading a number followed by a unit as a product: with factors
+// {"km": 1000, "m": 1}, "5km + 300m" is 5300. Unit names are matched
+// case-insensitively.
+func EvalWithUnits(expr string, factors map[string]float64) (float64, error) {
+	vars := make(map[string]float64, len(factors))
+	for name, f := range factors {
+		vars[strings.ToLower(name)] = f
+	}
+	return EvalExpressionWithOptions(expr, Options{Vars: vars, ImplicitMultiplication: true})
+}
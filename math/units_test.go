@@ -0,0 +1,33 @@
+package math
+
+import "testing"
+
+func TestEvalWithUnits(t *testing.T) {
+	factors := map[string]float64{"km": 1000, "m": 1, "cm": 0.01, "h": 3600, "min": 60}
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"5km + 300m", 5300},
+		{"2.5km", 2500},
+		{"150cm * 2", 3},
+		{"1h + 30min", 5400},
+		{"(1+1)km", 2000},
+		{"2KM", 2000},
+		{"max(1km, 900m)", 1000},
+	}
+
+	for _, tc := range cases {
+		got, err := EvalWithUnits(tc.expr, factors)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	if _, err := EvalWithUnits("5mi", factors); err == nil {
+		t.Fatalf("expected error for unknown unit")
+	}
+}
@@ -0,0 +1,133 @@
+package math
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Value is the result of Evaluate. Its dynamic type is FloatValue,
+// CentsValue, BigValue or BoolValue depending on the selected mode; use a
+// type switch to get at the exact result.
+type Value interface {
+	// Float64 returns the value as a float64, converting cents to units
+	// and booleans to 1 or 0.
+	Float64() float64
+	String() string
+}
+
+// FloatValue is a float64 result.
+type FloatValue float64
+
+func (v FloatValue) Float64() float64 { return float64(v) }
+func (v FloatValue) String() string   { return strconv.FormatFloat(float64(v), 'g', -1, 64) }
+
+// CentsValue is an exact money result in cents.
+type CentsValue int64
+
+func (v CentsValue) Float64() float64 { return float64(v) / 100 }
+func (v CentsValue) String() string   { return FormatCents(int64(v), moneyDecimals) }
+
+// BigValue is an arbitrary-precision result.
+type BigValue struct {
+	*big.Float
+}
+
+func (v BigValue) Float64() float64 {
+	f, _ := v.Float.Float64()
+	return f
+}
+
+// BoolValue is a truth value: any non-zero result is true.
+type BoolValue bool
+
+func (v BoolValue) Float64() float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+func (v BoolValue) String() string { return strconv.FormatBool(bool(v)) }
+
+type evalMode int
+
+const (
+	modeFloat evalMode = iota
+	modeMoney
+	modeBig
+	modeBool
+)
+
+type evalConfig struct {
+	mode      evalMode
+	prec      uint
+	opts      Options
+	moneyOpts MoneyOptions
+}
+
+// Option configures Evaluate.
+type Option func(*evalConfig)
+
+// AsMoney makes Evaluate compute exact cents and return a CentsValue.
+func AsMoney() Option {
+	return func(c *evalConfig) { c.mode = modeMoney }
+}
+
+// AsBig makes Evaluate use big.Float at prec bits and return a BigValue.
+func AsBig(prec uint) Option {
+	return func(c *evalConfig) { c.mode, c.prec = modeBig, prec }
+}
+
+// AsBool makes Evaluate return a BoolValue, for conditions such as
+// "total > 100 && paid".
+func AsBool() Option {
+	return func(c *evalConfig) { c.mode = modeBool }
+}
+
+// WithOptions sets the Options used in float and bool modes.
+func WithOptions(opts Options) Option {
+	return func(c *evalConfig) { c.opts = opts }
+}
+
+// WithMoneyOptions sets the MoneyOptions used in money mode.
+func WithMoneyOptions(opts MoneyOptions) Option {
+	return func(c *evalConfig) { c.moneyOpts = opts }
+}
+
+// Evaluate is a single entry point over EvalExpressionWithOptions,
+// EvalMoneyExpressionWithOptions and EvalExpressionBig. Without options it
+// returns a FloatValue.
+func Evaluate(expr string, opts ...Option) (Value, error) {
+	var c evalConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	switch c.mode {
+	case modeMoney:
+		cents, err := EvalMoneyExpressionWithOptions(expr, c.moneyOpts)
+		if err != nil {
+			return nil, err
+		}
+		return CentsValue(cents), nil
+	case modeBig:
+		f, err := EvalExpressionBig(expr, c.prec)
+		if err != nil {
+			return nil, err
+		}
+		return BigValue{f}, nil
+	}
+
+	v, err := EvalExpressionWithOptions(expr, c.opts)
+	if err != nil {
+		return nil, err
+	}
+	if c.mode == modeBool {
+		if math.IsNaN(v) {
+			return nil, errors.New("NaN has no truth value")
+		}
+		return BoolValue(v != 0), nil
+	}
+	return FloatValue(v), nil
+}
@@ -0,0 +1,60 @@
+package math
+
+import "testing"
+
+func TestEvaluate(t *testing.T) {
+	v, err := Evaluate("12.5*(3-1)/4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f, ok := v.(FloatValue); !ok || f != 6.25 {
+		t.Fatalf("wrong float result: %#v", v)
+	}
+
+	v, err = Evaluate("10/3", AsMoney())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c, ok := v.(CentsValue); !ok || c != 333 || c.String() != "3.33" {
+		t.Fatalf("wrong money result: %#v", v)
+	}
+
+	v, err = Evaluate("10/4", AsMoney(), WithMoneyOptions(MoneyOptions{Rounding: Floor}))
+	if err != nil || v.Float64() != 2.5 {
+		t.Fatalf("wrong money result with options: %v, %v", v, err)
+	}
+
+	v, err = Evaluate("1/3", AsBig(200))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, ok := v.(BigValue); !ok || b.Prec() != 200 || b.Text('f', 30) != "0.333333333333333333333333333333" {
+		t.Fatalf("wrong big result: %v", v)
+	}
+
+	cases := []struct {
+		expr string
+		want BoolValue
+	}{
+		{"2 > 1 && 3 >= 3", true},
+		{"x == 1", false},
+		{"x + 1", true},
+	}
+	vars := WithOptions(Options{Vars: map[string]float64{"x": 0}})
+	for _, tc := range cases {
+		v, err := Evaluate(tc.expr, AsBool(), vars)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.expr, err)
+		}
+		if v != tc.want {
+			t.Fatalf("wrong result for %q: got %v want %v", tc.expr, v, tc.want)
+		}
+	}
+
+	if _, err := Evaluate("nan", AsBool()); err == nil {
+		t.Fatalf("expected error for NaN in bool mode")
+	}
+	if _, err := Evaluate("sqrt(4)", AsMoney()); err == nil {
+		t.Fatalf("expected money mode to reject functions")
+	}
+}